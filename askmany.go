@@ -0,0 +1,70 @@
+package gpt
+
+import (
+	"context"
+	"sync"
+)
+
+// AskMany sends the requests with Ask, at most concurrency at once, and returns the completions and errors in their order.
+// The concurrency adapts to the rate limits: every request finishing while the transport is throttled
+// by 429 responses halves it, every other one raises it by one up to the given maximum.
+// The CustomId of the requests is not used.
+func (g *Gpt) AskMany(ctx context.Context, requests []GptRequest, concurrency int) ([]GptCompletion, []error) {
+	completions := make([]GptCompletion, len(requests))
+	errs := make([]error, len(requests))
+
+	limiter := newAdaptiveLimiter(max(concurrency, 1))
+	var wg sync.WaitGroup
+	for i, req := range requests {
+		limiter.acquire()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			completion, err := g.Ask(ctx, req.SystemPrompt, req.UserPrompt, req.Options...)
+			limiter.release(g.backoff.Throttled())
+			completions[i] = completion
+			if err != nil {
+				errs[i] = err
+			}
+		}()
+	}
+	wg.Wait()
+	return completions, errs
+}
+
+// adaptiveLimiter bounds the requests in flight, shrinking the bound multiplicatively while throttled
+// and growing it additively otherwise.
+type adaptiveLimiter struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	limit    int
+	max      int
+	inFlight int
+}
+
+func newAdaptiveLimiter(limit int) *adaptiveLimiter {
+	l := &adaptiveLimiter{limit: limit, max: limit}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+func (l *adaptiveLimiter) acquire() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for l.inFlight >= l.limit {
+		l.cond.Wait()
+	}
+	l.inFlight++
+}
+
+func (l *adaptiveLimiter) release(throttled bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inFlight--
+	if throttled {
+		l.limit = max(l.limit/2, 1)
+	} else if l.limit < l.max {
+		l.limit++
+	}
+	l.cond.Broadcast()
+}
@@ -40,6 +40,11 @@ func NewBackoffRoundTripper(transport http.RoundTripper) *BackoffRoundTripper {
 	}
 }
 
+// Throttled reports whether a 429 response switched the transport to sequential requests with backoff.
+func (rt *BackoffRoundTripper) Throttled() bool {
+	return rt.sequentialMode.Load()
+}
+
 func (rt *BackoffRoundTripper) RoundTrip(req *http.Request) (res *http.Response, err error) {
 	counter := 0
 	for {
@@ -91,12 +91,7 @@ func cancelBatch(ctx context.Context, c *http.Client, batchId string) goerror.Tr
 	return nil
 }
 
-func uploadBatch(ctx context.Context, c *http.Client, fileId string) (string, goerror.TraceableError) {
-	body := gptBatchRequest{
-		InputFileId:      fileId,
-		Endpoint:         "/v1/chat/completions",
-		CompletionWindow: "24h",
-	}
+func uploadBatch(ctx context.Context, c *http.Client, body gptBatchRequest) (string, goerror.TraceableError) {
 	serializedBody, err := json.Marshal(body)
 	if err != nil {
 		err = fmt.Errorf("failed to serialize body: %w", err)
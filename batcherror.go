@@ -0,0 +1,84 @@
+package gpt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// BatchValidationError lists the errors a batch failed with, usually because its input did not pass validation.
+// It is wrapped in ErrBatchFailed, use errors.As to get it.
+type BatchValidationError struct {
+	BatchId string
+	Errors  []BatchLineError
+}
+
+// BatchLineError is a single error of a failed batch.
+type BatchLineError struct {
+	// Line is the 1-based line of the input file, 0 if the error does not concern a single line.
+	Line    int
+	Param   string
+	Code    string
+	Message string
+	// CustomId is the custom_id of the line, if the input file could be read.
+	CustomId string
+}
+
+func (e BatchLineError) Error() string {
+	var b strings.Builder
+	if e.Line > 0 {
+		fmt.Fprintf(&b, "line %d", e.Line)
+		if e.CustomId != "" {
+			fmt.Fprintf(&b, " (%s)", e.CustomId)
+		}
+		b.WriteString(": ")
+	}
+	b.WriteString(e.Code)
+	if e.Param != "" {
+		fmt.Fprintf(&b, " at %s", e.Param)
+	}
+	fmt.Fprintf(&b, ": %s", e.Message)
+	return b.String()
+}
+
+func (e *BatchValidationError) Error() string {
+	lines := MapSlice(e.Errors, func(l BatchLineError) string { return l.Error() })
+	return fmt.Sprintf("batch %s failed with %d errors:\n%s", e.BatchId, len(e.Errors), strings.Join(lines, "\n"))
+}
+
+// validationError maps the errors of a failed batch to the custom_ids of their lines,
+// reading the input file from the session, the cache directory CreateBatch stored it in, or the Files API.
+// If the input can not be read, the errors are returned without custom_ids.
+func (s *GptBatchSession) validationError(ctx context.Context, batch GptBatchResponse) *BatchValidationError {
+	validationErr := &BatchValidationError{BatchId: batch.ID}
+	if batch.Errors == nil {
+		return validationErr
+	}
+
+	var lines [][]byte
+	if batch.InputFileID != "" {
+		input, err := s.getFile(ctx, batch.InputFileID)
+		if err != nil {
+			slog.Warn("Failed to read batch input for its errors", "error", err, "batchId", batch.ID)
+		} else {
+			lines = bytes.Split(input, []byte("\n"))
+		}
+	}
+
+	for _, e := range batch.Errors.Data {
+		lineErr := BatchLineError{Line: e.Line, Param: e.Param, Code: e.Code, Message: e.Message}
+		if e.Line > 0 && e.Line <= len(lines) {
+			var line struct {
+				CustomId string `json:"custom_id"`
+			}
+			if json.Unmarshal(lines[e.Line-1], &line) == nil {
+				lineErr.CustomId = line.CustomId
+			}
+		}
+		validationErr.Errors = append(validationErr.Errors, lineErr)
+	}
+	return validationErr
+}
@@ -0,0 +1,208 @@
+package gpt
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/FrauElster/goerror"
+)
+
+var ErrBatchMap = goerror.New("gpt:batch_map", "Batch map failed")
+
+type BatchMapOptions struct {
+	// Name names the batches and prefixes the custom_ids, it should be unique to the application.
+	Name string
+	// RequestOptions are applied to every request.
+	// They default to WithJsonSchema of Out for structs, and WithTextResponse for strings.
+	RequestOptions []RequestOption
+	// SessionOptions are applied to every batch session.
+	SessionOptions []BatchSessionOption
+	// PollInterval makes BatchMap and ResumeBatchMap wait for the batches, polling at this interval.
+	// If it is zero, they return ErrBatchNotCompleted and the token right away if the batches are still running.
+	PollInterval time.Duration
+}
+
+// BatchMapResult holds the results of BatchMap in the order of the inputs.
+// Results[i] is only valid if Errors[i] is nil.
+// The inputs of a batch that failed, expired or was cancelled without answering them get ErrBatchFailed,
+// the results of the other batches are kept.
+type BatchMapResult[Out any] struct {
+	// Token resumes the job with ResumeBatchMap, store it to collect the results from another process.
+	Token   string
+	Results []Out
+	Errors  []error
+}
+
+type batchMapToken struct {
+	Name     string   `json:"name"`
+	Inputs   int      `json:"inputs"`
+	BatchIds []string `json:"batch_ids"`
+}
+
+// BatchMap sends one request per input, built by buildPrompt, in as many batches as needed,
+// and decodes the answers into Out, a string receives the plain answer.
+// Unless opts.PollInterval is set, it returns ErrBatchNotCompleted with the result holding only the token.
+func BatchMap[In, Out any](ctx context.Context, g *Gpt, inputs []In, buildPrompt func(In) (system, user string), opts BatchMapOptions) (*BatchMapResult[Out], goerror.TraceableError) {
+	if opts.Name == "" {
+		return nil, ErrBatchMap.WithError(errors.New("name must not be empty")).WithOrigin()
+	}
+	if len(inputs) == 0 {
+		return &BatchMapResult[Out]{Results: []Out{}, Errors: []error{}}, nil
+	}
+	requestOptions := opts.RequestOptions
+	if requestOptions == nil {
+		requestOptions = defaultBatchMapOptions[Out]()
+	}
+
+	requests := make([]GptRequest, len(inputs))
+	for i, input := range inputs {
+		system, user := buildPrompt(input)
+		requests[i] = GptRequest{CustomId: batchMapCustomId(opts.Name, i), SystemPrompt: system, UserPrompt: user, Options: requestOptions}
+	}
+	batches, err := g.submitBatches(ctx, opts.Name, requests, opts.SessionOptions...)
+	if err != nil {
+		// the batches submitted so far can not be resumed without the rest, do not pay for them
+		g.cancelBatches(ctx, batches)
+		return nil, err
+	}
+
+	token := batchMapToken{Name: opts.Name, Inputs: len(inputs), BatchIds: MapSlice(batches, func(b submittedBatch) string { return b.BatchId })}
+	return collectBatchMap[Out](ctx, g, token, opts)
+}
+
+// ResumeBatchMap collects the results of a BatchMap by its token.
+// Only PollInterval and SessionOptions of opts are used.
+func ResumeBatchMap[Out any](ctx context.Context, g *Gpt, token string, opts BatchMapOptions) (*BatchMapResult[Out], goerror.TraceableError) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrBatchMap.WithError(fmt.Errorf("invalid token: %w", err)).WithOrigin()
+	}
+	var decoded batchMapToken
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, ErrBatchMap.WithError(fmt.Errorf("invalid token: %w", err)).WithOrigin()
+	}
+	return collectBatchMap[Out](ctx, g, decoded, opts)
+}
+
+func collectBatchMap[Out any](ctx context.Context, g *Gpt, token batchMapToken, opts BatchMapOptions) (*BatchMapResult[Out], goerror.TraceableError) {
+	data, _ := json.Marshal(token)
+	result := &BatchMapResult[Out]{Token: base64.RawURLEncoding.EncodeToString(data)}
+
+	session, err := g.NewBatchSession(opts.SessionOptions...)
+	if err != nil {
+		return result, err
+	}
+	completions := make(map[string]GptCompletion, token.Inputs)
+	errs := make(map[string]error)
+	// shardErrs holds the error of every input of a shard that failed, expired or was cancelled,
+	// unknownShardErrs the errors of such shards whose inputs could not be read
+	shardErrs := make(map[string]error)
+	var unknownShardErrs []error
+	for _, batchId := range token.BatchIds {
+		for {
+			batchCompletions, lineErrs, err := session.pollBatchedCompletions(ctx, batchId)
+			if errors.Is(err, ErrBatchNotCompleted) && opts.PollInterval > 0 {
+				select {
+				case <-ctx.Done():
+					return result, ErrBatchNotCompleted.WithError(ctx.Err()).WithOrigin()
+				case <-time.After(opts.PollInterval):
+					continue
+				}
+			}
+			if errors.Is(err, ErrBatchFailed) {
+				// the inputs of this shard get its error, the other shards are still collected
+				if customIds, idErr := session.inputCustomIds(ctx, batchId); idErr != nil {
+					unknownShardErrs = append(unknownShardErrs, err)
+				} else {
+					for _, customId := range customIds {
+						shardErrs[customId] = err
+					}
+				}
+				batchCompletions, lineErrs, err = session.retrievePartialCompletions(ctx, batchId)
+			}
+			if err != nil {
+				return result, err
+			}
+			for customId, completion := range batchCompletions {
+				completions[customId] = completion
+			}
+			for customId, lineErr := range lineErrs {
+				errs[customId] = lineErr
+			}
+			break
+		}
+	}
+
+	result.Results = make([]Out, token.Inputs)
+	result.Errors = make([]error, token.Inputs)
+	for i := range token.Inputs {
+		customId := batchMapCustomId(token.Name, i)
+		if lineErr, ok := errs[customId]; ok {
+			result.Errors[i] = ErrParseBatchLine.WithError(lineErr).WithOrigin()
+			continue
+		}
+		completion, ok := completions[customId]
+		if shardErr, failed := shardErrs[customId]; !ok && failed {
+			result.Errors[i] = shardErr
+			continue
+		}
+		if !ok && len(unknownShardErrs) > 0 {
+			result.Errors[i] = ErrBatchFailed.WithError(errors.Join(unknownShardErrs...)).WithOrigin()
+			continue
+		}
+		if !ok {
+			result.Errors[i] = ErrParseBatchLine.WithError(fmt.Errorf("no result for custom_id %q", customId)).WithOrigin()
+			continue
+		}
+		if err := decodeBatchMapOutput(completion.Content, &result.Results[i]); err != nil {
+			result.Errors[i] = ErrParseBatchLine.WithError(err).WithOrigin()
+		}
+	}
+	return result, nil
+}
+
+// inputCustomIds returns the custom_ids of the requests of a batch, read from its input file.
+func (s *GptBatchSession) inputCustomIds(ctx context.Context, batchId string) ([]string, goerror.TraceableError) {
+	batch, err := s.getBatch(ctx, batchId)
+	if err != nil {
+		return nil, err
+	}
+	input, err := s.getFile(ctx, batch.InputFileID)
+	if err != nil {
+		return nil, err
+	}
+	lines, err := readBatchInputLines(bytes.NewReader(input))
+	if err != nil {
+		return nil, err
+	}
+	return MapSlice(lines, func(l gptBatchInputLine) string { return l.CustomId }), nil
+}
+
+func batchMapCustomId(name string, i int) string {
+	return fmt.Sprintf("%s-%d", name, i)
+}
+
+func defaultBatchMapOptions[Out any]() []RequestOption {
+	var out Out
+	switch reflect.TypeOf(&out).Elem().Kind() {
+	case reflect.Struct:
+		return []RequestOption{WithJsonSchema(&out)}
+	case reflect.String:
+		return []RequestOption{WithTextResponse()}
+	}
+	return nil
+}
+
+func decodeBatchMapOutput[Out any](content []byte, out *Out) error {
+	if s, ok := any(out).(*string); ok {
+		*s = string(content)
+		return nil
+	}
+	return json.Unmarshal(content, out)
+}
@@ -11,6 +11,7 @@ import (
 	"os"
 	"path"
 	"reflect"
+	"sync"
 	"time"
 
 	"github.com/FrauElster/goerror"
@@ -23,32 +24,154 @@ var (
 	ErrSerializeBatchRequest = goerror.New("gpt:serialize_batch_request", "Failed to serialize batch request")
 	ErrExceedsFileLimit      = goerror.New("gpt:exceeds_file_limit", "Exceeds file limit")
 	ErrParseBatchLine        = goerror.New("gpt:parse_batch_line", "failed to parse batch line")
+	ErrMixedEndpoints        = goerror.New("gpt:mixed_endpoints", "A batch can only target a single endpoint")
 )
 
 type GptBatchSession struct {
-	client *http.Client
-	model  string
-	seed   int // https://platform.openai.com/docs/guides/text-generation/reproducible-outputs
+	client  *http.Client
+	backoff *BackoffRoundTripper
+	model   string
+	seed    int // https://platform.openai.com/docs/guides/text-generation/reproducible-outputs
 
-	// in-memory per session caches for retrieval
+	// every line of a batch has to target the same endpoint
+	endpoint         GptEndpoint
+	completionWindow string
+
+	// in-memory per session caches for retrieval, guarded by cacheMu so handles can be resolved concurrently
+	cacheMu sync.Mutex
 	batches map[string]GptBatchResponse
 	files   map[string][]byte
+	// parsed output files of completed batches by batch id
+	outputs map[string]parsedOutput
 
 	// for creation
 	createBatchData []byte
 	requestCount    int
+	estimates       []lineEstimate
+	countTokens     TokenCounter
+	// handles of the requests added, which get the batch id on CreateBatch
+	handles []*Handle
+	// canaryErr is set by a failed Canary and stops CreateBatch until the next Canary passes
+	canaryErr         goerror.TraceableError
+	canaryTolerance   float64
+	canaryConcurrency int
+	dryRunDir         string
 
 	cacheDir string
+	prices   PriceTable
+	// budget is the cap of this session, gptBudget the one shared with the Gpt instance
+	budget    *budget
+	gptBudget *budget
+}
+
+type BatchSessionOption func(*GptBatchSession)
+
+// supportedEndpoints are the endpoints the Batch API accepts.
+var supportedEndpoints = []GptEndpoint{EndpointChatCompletions, EndpointEmbeddings, EndpointResponses}
+
+// WithBatchEndpoint sets the endpoint all requests of the session target, defaults to EndpointChatCompletions.
+// Requests are built for this endpoint unless a RequestOption like WithResponsesApi selects another one,
+// which is rejected with ErrMixedEndpoints.
+// NewBatchSession returns ErrInvalidSessionOption for an endpoint the Batch API does not support.
+var WithBatchEndpoint = func(endpoint GptEndpoint) BatchSessionOption {
+	return func(s *GptBatchSession) {
+		if endpoint != "" {
+			s.endpoint = endpoint
+		}
+	}
+}
+
+// supportedCompletionWindows are the completion windows the Batch API accepts.
+var supportedCompletionWindows = []string{"24h"}
+
+// WithCompletionWindow sets the time frame within which the batch should be processed, defaults to "24h".
+// NewBatchSession returns ErrInvalidSessionOption for a window the Batch API does not support.
+var WithCompletionWindow = func(window string) BatchSessionOption {
+	return func(s *GptBatchSession) {
+		if window != "" {
+			s.completionWindow = window
+		}
+	}
 }
 
 type appliedRequestOption struct {
 	model          string
 	seed           int
+	endpoint       GptEndpoint
 	responseFormat gptResponseFormat
+	tools          *ToolRegistry
+	toolChoice     string
+	maxToolRounds  int
+	maxTokens      int
 }
 
 type RequestOption func(*appliedRequestOption) error
 
+func applyRequestOptions(model string, seed int, endpoint GptEndpoint, options []RequestOption) (*appliedRequestOption, error) {
+	opts := &appliedRequestOption{
+		model:          model,
+		seed:           seed,
+		endpoint:       endpoint,
+		responseFormat: gptResponseFormat{Type: "json_object"},
+	}
+	for _, opt := range options {
+		if err := opt(opts); err != nil {
+			return nil, err
+		}
+	}
+	return opts, nil
+}
+
+func (a *appliedRequestOption) promptRequest(systemPrompt, userPrompt string) gptPromptRequest {
+	req := gptPromptRequest{
+		Model: a.model,
+		Seed:  a.seed,
+		Messages: []gptMessage{
+			{Role: "system", Content: systemPrompt},
+			{Role: "user", Content: userPrompt},
+		},
+		Temperature:    0,
+		ResponseFormat: a.responseFormat,
+		MaxTokens:      a.maxTokens,
+	}
+	if a.tools != nil {
+		req.Tools = a.tools.definitions()
+	}
+	if a.toolChoice != "" {
+		req.ToolChoice = &gptToolChoice{Type: "function"}
+		req.ToolChoice.Function.Name = a.toolChoice
+	}
+	return req
+}
+
+// requestBody builds the body for the endpoint the request is sent to.
+func (a *appliedRequestOption) requestBody(systemPrompt, userPrompt string) any {
+	if a.endpoint == EndpointResponses {
+		return a.responsesRequest(systemPrompt, userPrompt)
+	}
+	return a.promptRequest(systemPrompt, userPrompt)
+}
+
+// WithMaxTokens limits the number of tokens the model may generate, including reasoning tokens.
+// It is also the bound for the output cost in GptBatchSession.Estimate.
+var WithMaxTokens = func(maxTokens int) RequestOption {
+	return func(a *appliedRequestOption) error {
+		if maxTokens <= 0 {
+			return fmt.Errorf("maxTokens must be positive, got %d", maxTokens)
+		}
+		a.maxTokens = maxTokens
+		return nil
+	}
+}
+
+// WithTextResponse lets the model answer in plain text instead of the default JSON object.
+var WithTextResponse = func() RequestOption {
+	return func(a *appliedRequestOption) error {
+		a.responseFormat = gptResponseFormat{Type: "text"}
+		return nil
+	}
+}
+
 // WithJsonSchema adds a JSON schema to the request as response format.
 // v must be a struct or pointer to a struct.
 var WithJsonSchema = func(v any) RequestOption {
@@ -74,41 +197,44 @@ var WithJsonSchema = func(v any) RequestOption {
 // It should have an application wide prefix to avoid collisions with other applications that batch data.
 // Further the customRequestId should be unique, a timestamp is a good choice.
 // The systemPrompt should describe the task and the userPrompt should contain the input data.
-// The callee is responsible for store the lineIdx of the request.
-// If AddToBatch is called the third time, the lineIdx of the request within the current batch is 2.
+// The returned Handle references the request, it gets its batch id once CreateBatch is called.
+// Store its String representation to retrieve the result later, see Handle.Result.
 // If the batch data exceeds the 512MB limit, ErrExceedsFileLimit is returned,
 // signaling that the s.CreateBatch() should be called to flush the current batch data
-func (s *GptBatchSession) AddToBatch(customRequestId, systemPrompt, userPrompt string, options ...RequestOption) goerror.TraceableError {
-	opts := &appliedRequestOption{
-		model:          s.model,
-		seed:           s.seed,
-		responseFormat: gptResponseFormat{Type: "json_object"},
+// If the estimated cost of the request crosses a budget (see WithBudget and WithBatchBudget), ErrBudgetExceeded is returned.
+// If the request targets another endpoint than the session (see WithBatchEndpoint), ErrMixedEndpoints is returned,
+// as it is for sessions targeting EndpointEmbeddings, which take their requests with GptEmbeddingBatchSession.AddToBatch.
+func (s *GptBatchSession) AddToBatch(customRequestId, systemPrompt, userPrompt string, options ...RequestOption) (*Handle, goerror.TraceableError) {
+	opts, err := applyRequestOptions(s.model, s.seed, s.endpoint, options)
+	if err != nil {
+		return nil, goerror.New("gpt:add_to_batch", "failed to apply option").WithError(err).WithOrigin()
 	}
-	for _, opt := range options {
-		if err := opt(opts); err != nil {
-			return goerror.New("gpt:add_to_batch", "failed to apply option").WithError(err).WithOrigin()
-		}
+	if opts.endpoint != EndpointChatCompletions && opts.endpoint != EndpointResponses {
+		err := fmt.Errorf("session targets %s, AddToBatch builds requests for %s or %s", opts.endpoint, EndpointChatCompletions, EndpointResponses)
+		return nil, ErrMixedEndpoints.WithError(err).WithOrigin()
 	}
 	req := gptBatchSingleRequest{
 		CustomId: customRequestId,
 		Method:   "POST",
-		Url:      "/v1/chat/completions",
-		Body: gptPromptRequest{
-			Model: opts.model,
-			Seed:  opts.seed,
-			Messages: []struct {
-				Role    string `json:"role"`
-				Content string `json:"content"`
-			}{
-				{Role: "system", Content: systemPrompt},
-				{Role: "user", Content: userPrompt},
-			},
-			Temperature:    0,
-			ResponseFormat: opts.responseFormat,
-		},
+		Url:      opts.endpoint,
+		Body:     opts.requestBody(systemPrompt, userPrompt),
+	}
+	if err := s.addLine(req, estimateRequest(s.countTokens, opts, systemPrompt, userPrompt)); err != nil {
+		return nil, err
 	}
 
-	if s.requestCount >= 50000 {
+	handle := &Handle{session: s, customId: customRequestId}
+	s.handles = append(s.handles, handle)
+	return handle, nil
+}
+
+func (s *GptBatchSession) addLine(req gptBatchSingleRequest, estimate lineEstimate) goerror.TraceableError {
+	if req.Url != s.endpoint {
+		err := fmt.Errorf("session targets %s, request %q targets %s", s.endpoint, req.CustomId, req.Url)
+		return ErrMixedEndpoints.WithError(err).WithOrigin()
+	}
+
+	if s.requestCount >= maxBatchRequests {
 		return ErrExceedsFileLimit.WithError(errors.New("exceeds request limit")).WithOrigin()
 	}
 
@@ -118,78 +244,134 @@ func (s *GptBatchSession) AddToBatch(customRequestId, systemPrompt, userPrompt s
 	}
 	serialized = append(serialized, '\n')
 
-	exceedsFileLimit := len(s.createBatchData)+len(serialized) > 512*1024*1024+1
+	exceedsFileLimit := len(s.createBatchData)+len(serialized) > maxBatchFileSize
 	if exceedsFileLimit {
 		return ErrExceedsFileLimit.WithOrigin()
 	}
 
+	cost, cErr := s.prices.estimateCost(estimate, true, s.budget, s.gptBudget)
+	if cErr != nil {
+		return cErr
+	}
+	if err := reserve(cost, s.budget, s.gptBudget); err != nil {
+		return err
+	}
+
 	s.createBatchData = append(s.createBatchData, serialized...)
 	s.requestCount++
+	s.estimates = append(s.estimates, estimate)
 	return nil
 }
 
+type CreateBatchOption func(*gptBatchRequest)
+
+// WithBatchMetadata attaches metadata to the batch, which can be used to find it again with Gpt.RetrieveBatches and WithMetadata.
+// OpenAI allows up to 16 pairs, keys up to 64 and values up to 512 characters.
+var WithBatchMetadata = func(metadata map[string]string) CreateBatchOption {
+	return func(r *gptBatchRequest) {
+		if r.Metadata == nil {
+			r.Metadata = make(map[string]string, len(metadata))
+		}
+		for key, value := range metadata {
+			r.Metadata[key] = value
+		}
+	}
+}
+
 // CreateBatch creates a new batch with the current batch data.
 // The batchName is used to identify the batch. It is the prefix for the file created and the batch created.
 // the batchname should be unique to this application, to differentiate between different batches of different applications.
 // CreateBatch will not clear its data. Create a new session to start a new batch.
-func (s *GptBatchSession) CreateBatch(ctx context.Context, batchName string) (string, goerror.TraceableError) {
+// The handles returned by AddToBatch reference the batch created last.
+// If a Canary of the session failed, its ErrCanaryFailed is returned.
+// With WithDryRun, nothing is uploaded, see there.
+func (s *GptBatchSession) CreateBatch(ctx context.Context, batchName string, options ...CreateBatchOption) (string, goerror.TraceableError) {
 	if len(s.createBatchData) == 0 {
 		return "", nil
 	}
+	if s.canaryErr != nil {
+		return "", s.canaryErr
+	}
 
-	filename := fmt.Sprintf("%s-%s.jsonl", batchName, time.Now().Format("2006-01-02T15-04-05"))
-	fileId, err := uploadBatchFile(ctx, s.client, filename, s.createBatchData)
-	if err != nil {
-		return "", err
+	body := gptBatchRequest{Endpoint: s.endpoint, CompletionWindow: s.completionWindow}
+	for _, opt := range options {
+		opt(&body)
+	}
+	if err := validateBatchMetadata(body.Metadata); err != nil {
+		return "", ErrCreateBatch.WithError(err).WithOrigin()
 	}
 
-	batchId, err := uploadBatch(ctx, s.client, fileId)
-	if err != nil {
-		return "", err
+	filename := fmt.Sprintf("%s-%s.jsonl", batchName, time.Now().Format("2006-01-02T15-04-05"))
+	var batchId string
+	if s.dryRunDir != "" {
+		var err goerror.TraceableError
+		if batchId, err = s.writeDryRun(filename, body); err != nil {
+			return "", err
+		}
+	} else {
+		fileId, err := uploadBatchFile(ctx, s.client, filename, s.createBatchData)
+		if err != nil {
+			return "", err
+		}
+
+		// keep the input, so errors of the batch can be mapped to custom_ids and failed requests resubmitted
+		// without downloading it, by other sessions too if there is a cache directory
+		s.storeFile(fileId, s.createBatchData)
+
+		body.InputFileId = fileId
+		if batchId, err = uploadBatch(ctx, s.client, body); err != nil {
+			return "", err
+		}
 	}
 
+	for _, handle := range s.handles {
+		handle.batchId = batchId
+	}
 	return batchId, nil
 }
 
+func validateBatchMetadata(metadata map[string]string) error {
+	if len(metadata) > 16 {
+		return fmt.Errorf("metadata has %d pairs, at most 16 are allowed", len(metadata))
+	}
+	for key, value := range metadata {
+		if len(key) > 64 {
+			return fmt.Errorf("metadata key %q exceeds 64 characters", key)
+		}
+		if len(value) > 512 {
+			return fmt.Errorf("metadata value of %q exceeds 512 characters", key)
+		}
+	}
+	return nil
+}
+
 // RetrieveBatchedRequest retrieves a single request from a batch.
 // The batchId is the id of the batch to retrieve the request from.
 // The lineIdx is the index of the request in the batch.
 // If the batch is not completed yet, ErrBatchNotCompleted is returned, which is more a flag indicating that the request should be retried later.
-// If the batch failed, ErrBatchFailed is returned, which contains the error that caused the batch to fail.
-// RetrieveBatchedRequest returns the raw []byte of the answer GPT gave (respnse.Body.Choices[0].Message.Content), since it is agnostic to the response format (could be JSON, could be plain text).
+// If the batch failed, ErrBatchFailed is returned, which wraps a *BatchValidationError listing the errors by line and custom_id.
+// RetrieveBatchedRequest returns the raw []byte of the answer GPT gave (respnse.Body.Choices[0].Message.Content, or the output text for the Responses API), since it is agnostic to the response format (could be JSON, could be plain text).
 // Sometimes GPT messes up, and a JSONL line is malformed. In this case ErrParseBatchLine is returned.
 // If you want to see the file itself causing that, just add a WithCacheDir to GPT instance and the file will be stored in the cache directory.
 func (s *GptBatchSession) RetrieveBatchedRequest(ctx context.Context, batchId string, lineIdx int) ([]byte, goerror.TraceableError) {
-	batch, err := s.getBatch(ctx, batchId)
+	completion, err := s.RetrieveBatchedCompletion(ctx, batchId, lineIdx)
 	if err != nil {
 		return nil, err
 	}
+	return completion.Content, nil
+}
 
-	if batch.Status == "failed" {
-		var batchErr error
-		if batch.Errors != nil && len(batch.Errors.Data) > 0 {
-			asErrs := MapSlice(batch.Errors.Data, func(e gptBatchError) error { return fmt.Errorf("%s: %s", e.Code, e.Message) })
-			batchErr = errors.Join(asErrs...)
-		}
-
-		return nil, ErrBatchFailed.WithError(batchErr).WithOrigin()
-	}
-
-	if batch.Status != "completed" {
-		return nil, ErrBatchNotCompleted.WithOrigin()
-	}
-
-	if batch.OutputFileID == nil {
-		return nil, ErrRequestBatch.WithError(errors.New("no output file ID")).WithOrigin()
-	}
-	file, err := s.getFile(ctx, *batch.OutputFileID)
+// RetrieveBatchedCompletion works like RetrieveBatchedRequest, but returns the whole completion including its tool calls.
+// Use it for requests made with WithToolChoice, their answer is in the tool call arguments and the content is empty.
+func (s *GptBatchSession) RetrieveBatchedCompletion(ctx context.Context, batchId string, lineIdx int) (GptCompletion, goerror.TraceableError) {
+	file, err := s.getOutputFile(ctx, batchId)
 	if err != nil {
-		return nil, err
+		return GptCompletion{}, err
 	}
 
 	lines := bytes.Split(file, []byte("\n"))
 	if lineIdx < 0 || lineIdx >= len(lines) {
-		return nil, ErrParseBatchLine.WithError(fmt.Errorf("line index out of bounds[0,%d]: %d", len(lines)-1, lineIdx)).WithOrigin()
+		return GptCompletion{}, ErrParseBatchLine.WithError(fmt.Errorf("line index out of bounds[0,%d]: %d", len(lines)-1, lineIdx)).WithOrigin()
 	}
 
 	rawResponse := lines[lineIdx]
@@ -197,21 +379,136 @@ func (s *GptBatchSession) RetrieveBatchedRequest(ctx context.Context, batchId st
 
 	if err := json.Unmarshal(rawResponse, &response); err != nil {
 		err = fmt.Errorf("failed to decode response: %w", err)
-		return nil, ErrParseBatchLine.WithError(err).WithOrigin()
+		return GptCompletion{}, ErrParseBatchLine.WithError(err).WithOrigin()
+	}
+	if err := response.err(); err != nil {
+		return GptCompletion{}, ErrParseBatchLine.WithError(err).WithOrigin()
+	}
+
+	completion, cErr := parseCompletionBody(response.Response.Body)
+	if cErr != nil {
+		return GptCompletion{}, ErrParseBatchLine.WithError(cErr).WithOrigin()
+	}
+	return completion, nil
+}
+
+// RetrieveBatchedCompletionById works like RetrieveBatchedCompletion, but looks the request up by its custom_id instead of the line index.
+func (s *GptBatchSession) RetrieveBatchedCompletionById(ctx context.Context, batchId, customRequestId string) (GptCompletion, goerror.TraceableError) {
+	completions, errs, err := s.retrieveBatchedCompletions(ctx, batchId)
+	if err != nil {
+		return GptCompletion{}, err
+	}
+	if lineErr, ok := errs[customRequestId]; ok {
+		return GptCompletion{}, ErrParseBatchLine.WithError(lineErr).WithOrigin()
+	}
+	completion, ok := completions[customRequestId]
+	if !ok {
+		return GptCompletion{}, ErrParseBatchLine.WithError(fmt.Errorf("no result for custom_id %q", customRequestId)).WithOrigin()
+	}
+	return completion, nil
+}
+
+type parsedOutput struct {
+	completions map[string]GptCompletion
+	errs        map[string]error
+}
+
+// retrieveBatchedCompletions parses all lines of the output file of a completed batch by custom_id.
+// Lines that could not be parsed are reported in the error map.
+// The output is parsed once per session, the returned maps are shared and must not be modified.
+func (s *GptBatchSession) retrieveBatchedCompletions(ctx context.Context, batchId string) (map[string]GptCompletion, map[string]error, goerror.TraceableError) {
+	s.cacheMu.Lock()
+	output, ok := s.outputs[batchId]
+	s.cacheMu.Unlock()
+	if ok {
+		return output.completions, output.errs, nil
+	}
+
+	file, err := s.getOutputFile(ctx, batchId)
+	if err != nil {
+		return nil, nil, err
+	}
+	output.completions, output.errs = parseBatchedCompletions(file)
+
+	s.cacheMu.Lock()
+	if s.outputs == nil {
+		s.outputs = make(map[string]parsedOutput)
+	}
+	s.outputs[batchId] = output
+	s.cacheMu.Unlock()
+	return output.completions, output.errs, nil
+}
+
+// err returns the error of a request that did not succeed.
+func (r gptBatchSingleResponse) err() error {
+	if r.Error != nil {
+		return fmt.Errorf("%s: %s", r.Error.Code, r.Error.Message)
+	}
+	if r.Response.StatusCode != http.StatusOK {
+		var body gptErrorBody
+		if json.Unmarshal(r.Response.Body, &body) == nil && body.Error.Message != "" {
+			return fmt.Errorf("server responded with non-OK status %d: %s", r.Response.StatusCode, body.Error.Message)
+		}
+		return fmt.Errorf("server responded with non-OK status: %d", r.Response.StatusCode)
 	}
-	if response.Response.StatusCode != http.StatusOK {
-		return nil, ErrParseBatchLine.WithError(fmt.Errorf("server responded with non-OK status: %d", response.Response.StatusCode)).WithOrigin()
+	return nil
+}
+
+func parseBatchedCompletions(file []byte) (map[string]GptCompletion, map[string]error) {
+	completions := make(map[string]GptCompletion)
+	errs := make(map[string]error)
+	for _, line := range bytes.Split(file, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var response gptBatchSingleResponse
+		if err := json.Unmarshal(line, &response); err != nil {
+			// without a custom_id the line can not be attributed
+			continue
+		}
+		if err := response.err(); err != nil {
+			errs[response.CustomId] = err
+			continue
+		}
+		completion, err := parseCompletionBody(response.Response.Body)
+		if err != nil {
+			errs[response.CustomId] = err
+			continue
+		}
+		completions[response.CustomId] = completion
+	}
+	return completions, errs
+}
+
+// getOutputFile returns the output file of a completed batch.
+func (s *GptBatchSession) getOutputFile(ctx context.Context, batchId string) ([]byte, goerror.TraceableError) {
+	batch, err := s.getBatch(ctx, batchId)
+	if err != nil {
+		return nil, err
+	}
+
+	if batch.Status == "failed" {
+		var batchErr error
+		if batch.Errors != nil && len(batch.Errors.Data) > 0 {
+			batchErr = s.validationError(ctx, batch)
+		}
+
+		return nil, ErrBatchFailed.WithError(batchErr).WithOrigin()
 	}
-	if len(response.Response.Body.Choices) == 0 {
-		return nil, ErrParseBatchLine.WithError(errors.New("gpt is clueless")).WithOrigin()
+
+	if batch.Status != "completed" {
+		return nil, ErrBatchNotCompleted.WithOrigin()
 	}
 
-	return []byte(response.Response.Body.Choices[0].Message.Content), nil
+	if batch.OutputFileID == nil {
+		return nil, ErrRequestBatch.WithError(errors.New("no output file ID")).WithOrigin()
+	}
+	return s.getFile(ctx, *batch.OutputFileID)
 }
 
 func (s *GptBatchSession) getBatch(ctx context.Context, batchId string) (GptBatchResponse, goerror.TraceableError) {
 	// check session cache
-	if batch, ok := s.batches[batchId]; ok {
+	if batch, ok := s.cachedBatch(batchId); ok {
 		return batch, nil
 	}
 
@@ -236,7 +533,7 @@ func (s *GptBatchSession) getBatch(ctx context.Context, batchId string) (GptBatc
 	if s.cacheDir != "" {
 		err := loadFromPersistentCache()
 		if err == nil {
-			s.batches[batchId] = result
+			s.cacheBatch(result)
 			return result, nil
 		}
 		if !errors.Is(err, os.ErrNotExist) {
@@ -251,7 +548,7 @@ func (s *GptBatchSession) getBatch(ctx context.Context, batchId string) (GptBatc
 	}
 
 	// fill session cache
-	s.batches[batchId] = result
+	s.cacheBatch(result)
 
 	// fill persisten cache if completed
 	if s.cacheDir != "" && result.Status == BatchStatusComplete {
@@ -266,9 +563,35 @@ func (s *GptBatchSession) getBatch(ctx context.Context, batchId string) (GptBatc
 	return result, nil
 }
 
+func (s *GptBatchSession) cachedBatch(batchId string) (GptBatchResponse, bool) {
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
+	batch, ok := s.batches[batchId]
+	return batch, ok
+}
+
+func (s *GptBatchSession) cacheBatch(batch GptBatchResponse) {
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
+	s.batches[batch.ID] = batch
+}
+
+func (s *GptBatchSession) cachedFile(fileId string) ([]byte, bool) {
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
+	file, ok := s.files[fileId]
+	return file, ok
+}
+
+func (s *GptBatchSession) cacheFile(fileId string, data []byte) {
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
+	s.files[fileId] = data
+}
+
 func (s *GptBatchSession) getFile(ctx context.Context, fileId string) ([]byte, goerror.TraceableError) {
 	// check session cache
-	if file, ok := s.files[fileId]; ok {
+	if file, ok := s.cachedFile(fileId); ok {
 		return file, nil
 	}
 
@@ -290,7 +613,7 @@ func (s *GptBatchSession) getFile(ctx context.Context, fileId string) ([]byte, g
 	if s.cacheDir != "" {
 		err := loadFromPersistentCache()
 		if err == nil {
-			s.files[fileId] = data
+			s.cacheFile(fileId, data)
 			return data, nil
 		}
 		if !errors.Is(err, os.ErrNotExist) {
@@ -304,7 +627,13 @@ func (s *GptBatchSession) getFile(ctx context.Context, fileId string) ([]byte, g
 		return nil, err
 	}
 
-	s.files[fileId] = data
+	s.storeFile(fileId, data)
+	return data, nil
+}
+
+// storeFile fills the session cache and the persistent cache with a file.
+func (s *GptBatchSession) storeFile(fileId string, data []byte) {
+	s.cacheFile(fileId, data)
 
 	if s.cacheDir != "" {
 		filepath := path.Join(s.cacheDir, fileId+".jsonl")
@@ -313,7 +642,6 @@ func (s *GptBatchSession) getFile(ctx context.Context, fileId string) ([]byte, g
 			slog.Error("Failed to write file to cache", "error", err, "fileId", fileId)
 		}
 	}
-	return data, nil
 }
 
 func getJsonSchema(v any) (map[string]any, error) {
@@ -0,0 +1,162 @@
+package gpt
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/FrauElster/goerror"
+)
+
+var ErrBudgetExceeded = goerror.New("gpt:budget_exceeded", "Budget exceeded")
+var ErrUnpricedModel = goerror.New("gpt:unpriced_model", "Model is missing from the price table")
+
+// budget tracks estimated spend in USD against a limit. It is safe for concurrent use.
+type budget struct {
+	mu    sync.Mutex
+	limit float64
+	spent float64
+}
+
+func newBudget(limit float64) *budget {
+	return &budget{limit: limit}
+}
+
+// reserve books cost on all budgets, or on none if any of them would be exceeded.
+// nil budgets are ignored.
+func reserve(cost float64, budgets ...*budget) goerror.TraceableError {
+	reserved := make([]*budget, 0, len(budgets))
+	for _, b := range budgets {
+		if b == nil {
+			continue
+		}
+		if err := b.reserve(cost); err != nil {
+			for _, r := range reserved {
+				r.release(cost)
+			}
+			return err
+		}
+		reserved = append(reserved, b)
+	}
+	return nil
+}
+
+func (b *budget) reserve(cost float64) goerror.TraceableError {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.spent+cost > b.limit {
+		err := fmt.Errorf("spending $%g on top of $%g exceeds the budget of $%g", cost, b.spent, b.limit)
+		return ErrBudgetExceeded.WithError(err).WithOrigin()
+	}
+	b.spent += cost
+	return nil
+}
+
+func (b *budget) release(cost float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.spent -= cost
+}
+
+// adjust replaces a reserved estimate with the actual cost, which may exceed the limit.
+func (b *budget) adjust(estimated, actual float64) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.spent += actual - estimated
+}
+
+func (b *budget) total() float64 {
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.spent
+}
+
+// WithBudget caps the estimated spend in USD of the Gpt instance, including all batch sessions created from it.
+// Batched requests are counted at batch prices when added, synchronous requests before they are sent,
+// and corrected by their actual usage afterwards.
+// Once the cap would be crossed, AddToBatch and synchronous calls return ErrBudgetExceeded.
+// The output of a request is estimated by its WithMaxTokens, without it only the input is counted up front,
+// so the cap can be crossed by the output of requests already sent.
+// Requests for models missing from the price table return ErrUnpricedModel, add their price with WithPriceTable.
+var WithBudget = func(usd float64) Option {
+	return func(g *Gpt) { g.budget = newBudget(usd) }
+}
+
+// WithBatchBudget caps the estimated spend in USD of a single session.
+// Once AddToBatch would cross the cap, it returns ErrBudgetExceeded and the request is not added.
+// Like WithBudget, it requires the models to be in the price table, and counts the output only with WithMaxTokens.
+var WithBatchBudget = func(usd float64) BatchSessionOption {
+	return func(s *GptBatchSession) { s.budget = newBudget(usd) }
+}
+
+// Spent returns the estimated spend in USD counted against the budget set by WithBudget.
+func (g *Gpt) Spent() float64 {
+	return g.budget.total()
+}
+
+// estimateCost prices an estimate, batch selects batch prices.
+// Unpriced models cost nothing, unless any of the budgets is set, then they can not be capped and ErrUnpricedModel is returned.
+func (t PriceTable) estimateCost(estimate lineEstimate, batch bool, budgets ...*budget) (float64, goerror.TraceableError) {
+	price, ok := t.Lookup(estimate.model)
+	if !ok {
+		for _, b := range budgets {
+			if b != nil {
+				return 0, ErrUnpricedModel.WithError(fmt.Errorf("model %q has no price to count against the budget", estimate.model)).WithOrigin()
+			}
+		}
+		return 0, nil
+	}
+	return price.Cost(GptUsage{PromptTokens: estimate.inputTokens, CompletionTokens: estimate.maxOutputTokens}, batch), nil
+}
+
+// releaseEstimates gives back what the session reserved for its requests at batch prices.
+func (s *GptBatchSession) releaseEstimates() {
+	for _, estimate := range s.estimates {
+		cost, _ := s.prices.estimateCost(estimate, true)
+		for _, b := range []*budget{s.budget, s.gptBudget} {
+			if b != nil {
+				b.release(cost)
+			}
+		}
+	}
+}
+
+// localBudget books the requests of a batch input run synchronously, at synchronous prices.
+type localBudget struct {
+	prices      PriceTable
+	countTokens TokenCounter
+	budgets     []*budget
+}
+
+// reserve books the estimated cost of the line and returns it.
+func (b localBudget) reserve(line gptBatchInputLine) (float64, goerror.TraceableError) {
+	estimated, err := b.prices.estimateCost(estimateBody(b.countTokens, line.Body), false, b.budgets...)
+	if err != nil {
+		return 0, err
+	}
+	if err := reserve(estimated, b.budgets...); err != nil {
+		return 0, err
+	}
+	return estimated, nil
+}
+
+// adjust replaces the estimate of a line with the cost of its response, failed requests cost nothing.
+func (b localBudget) adjust(estimated float64, response gptBatchSingleResponse) {
+	actual := 0.0
+	if response.err() == nil {
+		if model, usage, err := parseUsageBody(response.Response.Body); err == nil {
+			if price, ok := b.prices.Lookup(model); ok {
+				actual = price.Cost(usage, false)
+			}
+		}
+	}
+	for _, budget := range b.budgets {
+		budget.adjust(estimated, actual)
+	}
+}
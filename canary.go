@@ -0,0 +1,93 @@
+package gpt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+
+	"github.com/FrauElster/goerror"
+)
+
+var ErrCanaryFailed = goerror.New("gpt:canary_failed", "Too many canary requests failed")
+
+// WithCanaryTolerance sets the share of canary requests that may fail without failing the canary, defaults to 0.
+var WithCanaryTolerance = func(tolerance float64) BatchSessionOption {
+	return func(s *GptBatchSession) {
+		if tolerance >= 0 && tolerance <= 1 {
+			s.canaryTolerance = tolerance
+		}
+	}
+}
+
+// WithCanaryConcurrency sets the maximum number of canary requests sent at once, defaults to 8, see AskMany.
+var WithCanaryConcurrency = func(concurrency int) BatchSessionOption {
+	return func(s *GptBatchSession) {
+		if concurrency > 0 {
+			s.canaryConcurrency = concurrency
+		}
+	}
+}
+
+// Canary sends a random sample of n requests of the session synchronously, before the batch is created,
+// and checks their answers with validate, which may be nil to only check that the requests succeed.
+// It returns the errors of the sampled requests that failed by custom_id.
+// If more than the tolerance (see WithCanaryTolerance) failed, ErrCanaryFailed is returned
+// and CreateBatch refuses to create the batch of this session, until a later Canary passes.
+// The sampled requests are sent again with the batch, they are counted against the budgets at synchronous prices
+// on top of what AddToBatch reserved, a request that would cross them fails the canary.
+func (s *GptBatchSession) Canary(ctx context.Context, n int, validate func(customId string, content []byte) error) (map[string]error, goerror.TraceableError) {
+	s.canaryErr = nil
+	lines := bytes.SplitAfter(s.createBatchData, []byte("\n"))
+	if len(lines) > 0 && len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	n = min(n, len(lines))
+	if n <= 0 {
+		return map[string]error{}, nil
+	}
+
+	sample := make([]byte, 0)
+	for _, idx := range rand.Perm(len(lines))[:n] {
+		sample = append(sample, lines[idx]...)
+	}
+	concurrency := s.canaryConcurrency
+	if concurrency == 0 {
+		concurrency = 8
+	}
+	var output bytes.Buffer
+	if err := executeBatchLocally(ctx, s.client, s.backoff, s.localBudget(), bytes.NewReader(sample), &output, concurrency); err != nil {
+		return nil, err
+	}
+
+	completions, failures := parseBatchedCompletions(output.Bytes())
+	if validate != nil {
+		for customId, completion := range completions {
+			if err := validate(customId, completion.Content); err != nil {
+				failures[customId] = err
+			}
+		}
+	}
+
+	if float64(len(failures)) > s.canaryTolerance*float64(n) {
+		joined := make([]error, 0, len(failures))
+		for customId, err := range failures {
+			joined = append(joined, fmt.Errorf("%s: %w", customId, err))
+		}
+		err := fmt.Errorf("%d of %d canary requests failed: %w", len(failures), n, errors.Join(joined...))
+		s.canaryErr = ErrCanaryFailed.WithError(err).WithOrigin()
+		return failures, s.canaryErr
+	}
+	return failures, nil
+}
+
+// ValidateJson is a Canary validation checking that the answer decodes into T without unknown fields,
+// use it as Canary(ctx, n, ValidateJson[T]) with the type given to WithJsonSchema.
+func ValidateJson[T any](customId string, content []byte) error {
+	var v T
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(&v)
+}
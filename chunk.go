@@ -0,0 +1,207 @@
+package gpt
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/FrauElster/goerror"
+	"github.com/FrauElster/gogpt/tokenizer"
+)
+
+var ErrChunkText = goerror.New("gpt:chunk_text", "Failed to chunk text")
+
+type ChunkMode string
+
+const (
+	// ChunkByTokens cuts the text every MaxTokens tokens, regardless of words or sentences.
+	ChunkByTokens ChunkMode = "tokens"
+	// ChunkBySentences packs whole sentences into chunks.
+	ChunkBySentences ChunkMode = "sentences"
+	// ChunkByParagraphs packs whole paragraphs, separated by blank lines, into chunks.
+	ChunkByParagraphs ChunkMode = "paragraphs"
+)
+
+type ChunkOptions struct {
+	Mode ChunkMode
+	// Model selects the encoding used to count tokens, see tokenizer.ForModel.
+	Model string
+	// MaxTokens is the token budget of a single chunk.
+	MaxTokens int
+	// Overlap is the number of tokens a chunk repeats from the end of the previous one.
+	// In sentence and paragraph mode, only whole sentences or paragraphs are repeated.
+	Overlap int
+}
+
+// Chunk is a piece of a longer document.
+// Its Id is stable for the same document id and chunking, so it can be used as customRequestId in AddToBatch.
+type Chunk struct {
+	Id     string
+	Index  int
+	Text   string
+	Tokens int
+}
+
+// ChunkId returns the id of the chunk at index of the document.
+func ChunkId(documentId string, index int) string {
+	return fmt.Sprintf("%s-chunk-%d", documentId, index)
+}
+
+// ParseChunkId returns the document id and the index of a chunk id created by ChunkId.
+func ParseChunkId(chunkId string) (documentId string, index int, ok bool) {
+	idx := strings.LastIndex(chunkId, "-chunk-")
+	if idx < 0 {
+		return "", 0, false
+	}
+	index, err := strconv.Atoi(chunkId[idx+len("-chunk-"):])
+	if err != nil {
+		return "", 0, false
+	}
+	return chunkId[:idx], index, true
+}
+
+var (
+	sentenceEnd  = regexp.MustCompile(`[.!?…。！？]+["'”’)\]]*\s+`)
+	paragraphEnd = regexp.MustCompile(`\n[ \t]*\n\s*`)
+)
+
+// ChunkText splits text into chunks that fit the token budget.
+// Sentences or paragraphs longer than MaxTokens are cut by tokens.
+func ChunkText(documentId, text string, opts ChunkOptions) ([]Chunk, goerror.TraceableError) {
+	if opts.MaxTokens <= 0 {
+		return nil, ErrChunkText.WithError(fmt.Errorf("MaxTokens must be positive, got %d", opts.MaxTokens)).WithOrigin()
+	}
+	if opts.Overlap < 0 || opts.Overlap >= opts.MaxTokens {
+		return nil, ErrChunkText.WithError(fmt.Errorf("Overlap must be in [0,%d), got %d", opts.MaxTokens, opts.Overlap)).WithOrigin()
+	}
+	encoding, err := tokenizer.ForModel(opts.Model)
+	if err != nil {
+		return nil, ErrChunkText.WithError(err).WithOrigin()
+	}
+
+	var texts []string
+	switch opts.Mode {
+	case ChunkByTokens, "":
+		texts = chunkByTokens(encoding, text, opts.MaxTokens, opts.Overlap)
+	case ChunkBySentences:
+		texts = chunkUnits(encoding, splitAfter(text, sentenceEnd), opts.MaxTokens, opts.Overlap)
+	case ChunkByParagraphs:
+		texts = chunkUnits(encoding, splitAfter(text, paragraphEnd), opts.MaxTokens, opts.Overlap)
+	default:
+		return nil, ErrChunkText.WithError(fmt.Errorf("unknown chunk mode %q", opts.Mode)).WithOrigin()
+	}
+
+	chunks := make([]Chunk, len(texts))
+	for i, t := range texts {
+		chunks[i] = Chunk{Id: ChunkId(documentId, i), Index: i, Text: t, Tokens: encoding.Count(t)}
+	}
+	return chunks, nil
+}
+
+// splitAfter splits text after every match of sep, keeping the separator with the preceding unit.
+func splitAfter(text string, sep *regexp.Regexp) []string {
+	units := make([]string, 0)
+	start := 0
+	for _, loc := range sep.FindAllStringIndex(text, -1) {
+		units = append(units, text[start:loc[1]])
+		start = loc[1]
+	}
+	if start < len(text) {
+		units = append(units, text[start:])
+	}
+	return units
+}
+
+func chunkByTokens(encoding *tokenizer.Encoding, text string, maxTokens, overlap int) []string {
+	tokens := encoding.Encode(text)
+	chunks := make([]string, 0, len(tokens)/maxTokens+1)
+	for start := 0; start < len(tokens); {
+		end := min(start+maxTokens, len(tokens))
+
+		// a token boundary may split a multi-byte character, move the window to whole characters
+		for start < end-1 && !startsCharacter(encoding.Decode(tokens[start:start+1])) {
+			start++
+		}
+		chunk := encoding.Decode(tokens[start:end])
+		for end < len(tokens) && end > start+1 && !utf8.ValidString(chunk) {
+			end--
+			chunk = encoding.Decode(tokens[start:end])
+		}
+		chunks = append(chunks, chunk)
+
+		if end == len(tokens) {
+			break
+		}
+		start = max(end-overlap, start+1)
+	}
+	return chunks
+}
+
+func startsCharacter(s string) bool {
+	return len(s) == 0 || utf8.RuneStart(s[0])
+}
+
+// chunkUnits packs consecutive units into chunks of at most maxTokens,
+// repeating trailing units of the previous chunk up to overlap tokens.
+func chunkUnits(encoding *tokenizer.Encoding, units []string, maxTokens, overlap int) []string {
+	type unit struct {
+		text   string
+		tokens int
+	}
+
+	// units exceeding the budget on their own are cut by tokens
+	sized := make([]unit, 0, len(units))
+	for _, u := range units {
+		tokens := encoding.Count(u)
+		if tokens <= maxTokens {
+			sized = append(sized, unit{u, tokens})
+			continue
+		}
+		for _, part := range chunkByTokens(encoding, u, maxTokens, 0) {
+			sized = append(sized, unit{part, encoding.Count(part)})
+		}
+	}
+
+	chunks := make([]string, 0)
+	var current []unit
+	currentTokens := 0
+	added := 0 // units in current that are not part of a previous chunk
+	flush := func() {
+		var b strings.Builder
+		for _, u := range current {
+			b.WriteString(u.text)
+		}
+		chunks = append(chunks, b.String())
+
+		// keep the trailing units fitting into the overlap for the next chunk
+		keep := len(current)
+		kept := 0
+		for keep > 0 && kept+current[keep-1].tokens <= overlap {
+			keep--
+			kept += current[keep].tokens
+		}
+		current = append([]unit(nil), current[keep:]...)
+		currentTokens = kept
+		added = 0
+	}
+
+	for _, u := range sized {
+		if currentTokens+u.tokens > maxTokens && len(current) > 0 {
+			flush()
+			// the overlap must not push the new unit over the budget
+			for len(current) > 0 && currentTokens+u.tokens > maxTokens {
+				currentTokens -= current[0].tokens
+				current = current[1:]
+			}
+		}
+		current = append(current, u)
+		currentTokens += u.tokens
+		added++
+	}
+	if added > 0 {
+		flush()
+	}
+	return chunks
+}
@@ -0,0 +1,162 @@
+package gpt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/FrauElster/goerror"
+)
+
+func createCompletion(ctx context.Context, c *http.Client, body gptPromptRequest) (gptPromptResponse, goerror.TraceableError) {
+	serializedBody, err := json.Marshal(body)
+	if err != nil {
+		err = fmt.Errorf("failed to serialize body: %w", err)
+		return gptPromptResponse{}, ErrGptAsk.WithError(err).WithOrigin()
+	}
+
+	url := "https://api.openai.com/v1/chat/completions"
+	req, err := http.NewRequest("POST", url, bytes.NewReader(serializedBody))
+	if err != nil {
+		return gptPromptResponse{}, ErrGptAsk.WithError(err).WithOrigin()
+	}
+	req = req.WithContext(ctx)
+	req.Header = http.Header{"Content-Type": {"application/json"}}
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return gptPromptResponse{}, ErrGptAsk.WithError(err).WithOrigin()
+	}
+
+	decodedResponse, err := parseResponse[gptPromptResponse](resp)
+	if err != nil {
+		return gptPromptResponse{}, ErrGptAsk.WithError(err).WithOrigin()
+	}
+
+	return decodedResponse, nil
+}
+
+// completion converts the first choice of the response into a GptCompletion.
+func (r gptPromptResponse) completion() (GptCompletion, error) {
+	if len(r.Choices) == 0 {
+		return GptCompletion{}, errors.New("gpt is clueless")
+	}
+
+	choice := r.Choices[0]
+	return GptCompletion{
+		Model:        r.Model,
+		Content:      []byte(choice.Message.Content),
+		ToolCalls:    choice.Message.ToolCalls,
+		FinishReason: choice.FinishReason,
+		Usage: GptUsage{
+			PromptTokens:     r.Usage.PromptTokens,
+			CachedTokens:     r.Usage.PromptTokensDetails.CachedTokens,
+			CompletionTokens: r.Usage.CompletionTokens,
+			ReasoningTokens:  r.Usage.CompletionTokensDetails.ReasoningTokens,
+		},
+	}, nil
+}
+
+// conversation is a synchronous exchange with one of the completion endpoints, which can be continued with tool results.
+type conversation interface {
+	send(ctx context.Context, client *http.Client) (GptCompletion, goerror.TraceableError)
+	addToolResults(completion GptCompletion, results []string)
+}
+
+// chatConversation is a conversation with the chat completions API.
+type chatConversation struct {
+	req  gptPromptRequest
+	last gptMessage
+}
+
+func (c *chatConversation) send(ctx context.Context, client *http.Client) (GptCompletion, goerror.TraceableError) {
+	resp, err := createCompletion(ctx, client, c.req)
+	if err != nil {
+		return GptCompletion{}, err
+	}
+	completion, cErr := resp.completion()
+	if cErr != nil {
+		return GptCompletion{}, ErrGptAsk.WithError(cErr).WithOrigin()
+	}
+	c.last = resp.Choices[0].Message
+	return completion, nil
+}
+
+func (c *chatConversation) addToolResults(completion GptCompletion, results []string) {
+	// a forced tool call applies to the first round only, otherwise the model could never answer
+	c.req.ToolChoice = nil
+	c.req.Messages = append(c.req.Messages, c.last)
+	for i, call := range completion.ToolCalls {
+		c.req.Messages = append(c.req.Messages, gptMessage{Role: "tool", Content: results[i], ToolCallId: call.Id})
+	}
+}
+
+func (a *appliedRequestOption) conversation(systemPrompt, userPrompt string) conversation {
+	if a.endpoint == EndpointResponses {
+		return &responsesConversation{req: a.responsesRequest(systemPrompt, userPrompt)}
+	}
+	return &chatConversation{req: a.promptRequest(systemPrompt, userPrompt)}
+}
+
+// Ask sends a single synchronous chat completion.
+// It accepts the same RequestOptions as GptBatchSession.AddToBatch.
+// If the model answers with tool calls, they are returned in GptCompletion.ToolCalls,
+// unless WithAgentLoop is given, in which case the registered tools are invoked and their results are fed back
+// until the model gives a final answer.
+// If the estimated cost crosses the budget set by WithBudget, ErrBudgetExceeded is returned.
+func (g *Gpt) Ask(ctx context.Context, systemPrompt, userPrompt string, options ...RequestOption) (GptCompletion, goerror.TraceableError) {
+	opts, err := applyRequestOptions(g.model, g.seed, EndpointChatCompletions, options)
+	if err != nil {
+		return GptCompletion{}, ErrGptAsk.WithError(err).WithOrigin()
+	}
+
+	estimated, cErr := g.prices.estimateCost(estimateRequest(g.countTokens, opts, systemPrompt, userPrompt), false, g.budget)
+	if cErr != nil {
+		return GptCompletion{}, cErr
+	}
+	if err := reserve(estimated, g.budget); err != nil {
+		return GptCompletion{}, err
+	}
+
+	completion, usage, askErr := g.ask(ctx, opts, opts.conversation(systemPrompt, userPrompt))
+	actual := 0.0
+	if price, ok := g.prices.Lookup(opts.model); ok {
+		actual = price.Cost(usage, false)
+	}
+	g.budget.adjust(estimated, actual)
+
+	return completion, askErr
+}
+
+// ask runs the conversation, including the agent loop, and returns the usage of all rounds.
+func (g *Gpt) ask(ctx context.Context, opts *appliedRequestOption, conv conversation) (GptCompletion, GptUsage, goerror.TraceableError) {
+	var usage GptUsage
+	for round := 0; ; round++ {
+		completion, err := conv.send(ctx, g.client)
+		if err != nil {
+			return GptCompletion{}, usage, err
+		}
+		usage = usage.add(completion.Usage)
+
+		if len(completion.ToolCalls) == 0 || opts.maxToolRounds == 0 || opts.tools == nil {
+			return completion, usage, nil
+		}
+		if round >= opts.maxToolRounds {
+			return completion, usage, ErrToolLoop.WithError(fmt.Errorf("still calling tools after %d rounds", round)).WithOrigin()
+		}
+
+		results := make([]string, len(completion.ToolCalls))
+		for i, call := range completion.ToolCalls {
+			result, err := opts.tools.Call(ctx, call)
+			if err != nil {
+				// let the model know, it might be able to recover
+				result = fmt.Sprintf("error: %s", err.Unwrap())
+			}
+			results[i] = result
+		}
+		conv.addToolResults(completion, results)
+	}
+}
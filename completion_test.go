@@ -0,0 +1,108 @@
+package gpt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+)
+
+// fakeTransport answers every request with the next of its responses and records the request bodies.
+type fakeTransport struct {
+	responses []string
+	requests  []map[string]any
+}
+
+func (f *fakeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, _ := io.ReadAll(req.Body)
+	var decoded map[string]any
+	_ = json.Unmarshal(body, &decoded)
+	f.requests = append(f.requests, decoded)
+
+	response := f.responses[0]
+	f.responses = f.responses[1:]
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Status:     "200 OK",
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(bytes.NewReader([]byte(response))),
+	}, nil
+}
+
+type weatherArgs struct {
+	City string `json:"city"`
+}
+
+func newFakeGpt(t *testing.T, responses ...string) (*Gpt, *fakeTransport, *ToolRegistry) {
+	t.Helper()
+	g, err := NewGpt("token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport := &fakeTransport{responses: responses}
+	g.client = &http.Client{Transport: transport}
+
+	weather, tErr := NewFuncTool("get_weather", "Returns the weather", func(ctx context.Context, args weatherArgs) (string, error) {
+		return "sunny in " + args.City, nil
+	})
+	if tErr != nil {
+		t.Fatal(tErr)
+	}
+	tools, tErr := NewToolRegistry(weather)
+	if tErr != nil {
+		t.Fatal(tErr)
+	}
+	return g, transport, tools
+}
+
+func TestAskToolChoiceOnlyForcesFirstRound(t *testing.T) {
+	g, transport, tools := newFakeGpt(t,
+		`{"model":"gpt-4o-mini","choices":[{"finish_reason":"tool_calls","message":{"role":"assistant","tool_calls":[{"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Berlin\"}"}}]}}]}`,
+		`{"model":"gpt-4o-mini","choices":[{"finish_reason":"stop","message":{"role":"assistant","content":"It is sunny."}}]}`,
+	)
+
+	completion, err := g.Ask(context.Background(), "system", "weather in Berlin?",
+		WithTextResponse(), WithTools(tools), WithToolChoice("get_weather"), WithAgentLoop(3))
+	if err != nil {
+		t.Fatalf("Ask failed: %v", err)
+	}
+	if string(completion.Content) != "It is sunny." {
+		t.Errorf("content = %q", completion.Content)
+	}
+	if len(transport.requests) != 2 {
+		t.Fatalf("sent %d requests, want 2", len(transport.requests))
+	}
+	if transport.requests[0]["tool_choice"] == nil {
+		t.Error("first round does not force the tool")
+	}
+	if choice, ok := transport.requests[1]["tool_choice"]; ok {
+		t.Errorf("second round still forces the tool: %v", choice)
+	}
+}
+
+func TestAskResponsesToolChoiceOnlyForcesFirstRound(t *testing.T) {
+	g, transport, tools := newFakeGpt(t,
+		`{"object":"response","model":"gpt-4o-mini","status":"completed","output":[{"type":"function_call","call_id":"call_1","name":"get_weather","arguments":"{\"city\":\"Berlin\"}"}]}`,
+		`{"object":"response","model":"gpt-4o-mini","status":"completed","output":[{"type":"message","role":"assistant","content":[{"type":"output_text","text":"It is sunny."}]}]}`,
+	)
+
+	completion, err := g.Ask(context.Background(), "system", "weather in Berlin?",
+		WithResponsesApi(), WithTextResponse(), WithTools(tools), WithToolChoice("get_weather"), WithAgentLoop(3))
+	if err != nil {
+		t.Fatalf("Ask failed: %v", err)
+	}
+	if string(completion.Content) != "It is sunny." {
+		t.Errorf("content = %q", completion.Content)
+	}
+	if len(transport.requests) != 2 {
+		t.Fatalf("sent %d requests, want 2", len(transport.requests))
+	}
+	if transport.requests[0]["tool_choice"] == nil {
+		t.Error("first round does not force the tool")
+	}
+	if choice, ok := transport.requests[1]["tool_choice"]; ok {
+		t.Errorf("second round still forces the tool: %v", choice)
+	}
+}
@@ -0,0 +1,67 @@
+package gpt
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	"github.com/FrauElster/goerror"
+)
+
+var ErrDryRun = goerror.New("gpt:dry_run", "Failed to write dry run")
+
+// WithDryRun makes CreateBatch write the batch input JSONL and a summary to dir instead of uploading it,
+// and return a synthetic batch id, which can not be retrieved.
+// The files are named <batchId>.jsonl and <batchId>.summary.json.
+var WithDryRun = func(dir string) BatchSessionOption {
+	return func(s *GptBatchSession) { s.dryRunDir = dir }
+}
+
+type dryRunSummary struct {
+	BatchId           string            `json:"batch_id"`
+	Filename          string            `json:"filename"`
+	Endpoint          GptEndpoint       `json:"endpoint"`
+	CompletionWindow  string            `json:"completion_window"`
+	Metadata          map[string]string `json:"metadata,omitempty"`
+	Lines             int               `json:"lines"`
+	Bytes             int               `json:"bytes"`
+	Models            []string          `json:"models"`
+	InputTokens       int               `json:"input_tokens"`
+	MaxOutputTokens   int               `json:"max_output_tokens"`
+	UnboundedRequests int               `json:"unbounded_requests"`
+	Cost              float64           `json:"estimated_cost_usd"`
+	Unpriced          []string          `json:"unpriced,omitempty"`
+}
+
+// writeDryRun writes what CreateBatch would upload to the dry run directory.
+func (s *GptBatchSession) writeDryRun(filename string, body gptBatchRequest) (string, goerror.TraceableError) {
+	batchId := fmt.Sprintf("dry_run_batch_%d", time.Now().UnixNano())
+	estimate := s.Estimate()
+	summary := dryRunSummary{
+		BatchId:           batchId,
+		Filename:          filename,
+		Endpoint:          body.Endpoint,
+		CompletionWindow:  body.CompletionWindow,
+		Metadata:          body.Metadata,
+		Lines:             s.requestCount,
+		Bytes:             len(s.createBatchData),
+		Models:            estimate.Models,
+		InputTokens:       estimate.InputTokens,
+		MaxOutputTokens:   estimate.MaxOutputTokens,
+		UnboundedRequests: estimate.UnboundedRequests,
+		Cost:              estimate.Cost,
+		Unpriced:          estimate.Unpriced,
+	}
+
+	if err := os.MkdirAll(s.dryRunDir, 0755); err != nil {
+		return "", ErrDryRun.WithError(err).WithOrigin()
+	}
+	if err := os.WriteFile(path.Join(s.dryRunDir, batchId+".jsonl"), s.createBatchData, 0644); err != nil {
+		return "", ErrDryRun.WithError(err).WithOrigin()
+	}
+	if err := writeJsonFile(path.Join(s.dryRunDir, batchId+".summary.json"), summary); err != nil {
+		return "", ErrDryRun.WithError(err).WithOrigin()
+	}
+	return batchId, nil
+}
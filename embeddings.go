@@ -0,0 +1,196 @@
+package gpt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/FrauElster/goerror"
+)
+
+var ErrEmbed = goerror.New("gpt:embed", "Failed to create embeddings")
+
+func createEmbeddings(ctx context.Context, c *http.Client, body gptEmbeddingRequest) (gptEmbeddingResponse, goerror.TraceableError) {
+	serializedBody, err := json.Marshal(body)
+	if err != nil {
+		err = fmt.Errorf("failed to serialize body: %w", err)
+		return gptEmbeddingResponse{}, ErrEmbed.WithError(err).WithOrigin()
+	}
+
+	url := "https://api.openai.com/v1/embeddings"
+	req, err := http.NewRequest("POST", url, bytes.NewReader(serializedBody))
+	if err != nil {
+		return gptEmbeddingResponse{}, ErrEmbed.WithError(err).WithOrigin()
+	}
+	req = req.WithContext(ctx)
+	req.Header = http.Header{"Content-Type": {"application/json"}}
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return gptEmbeddingResponse{}, ErrEmbed.WithError(err).WithOrigin()
+	}
+
+	decodedResponse, err := parseResponse[gptEmbeddingResponse](resp)
+	if err != nil {
+		return gptEmbeddingResponse{}, ErrEmbed.WithError(err).WithOrigin()
+	}
+
+	return decodedResponse, nil
+}
+
+// vectors returns the embeddings ordered like the inputs of the request.
+func (r gptEmbeddingResponse) vectors() ([][]float32, error) {
+	vectors := make([][]float32, len(r.Data))
+	for _, d := range r.Data {
+		if d.Index < 0 || d.Index >= len(vectors) {
+			return nil, fmt.Errorf("embedding index out of bounds[0,%d]: %d", len(vectors)-1, d.Index)
+		}
+		vectors[d.Index] = d.Embedding
+	}
+	return vectors, nil
+}
+
+// Embed creates embeddings for the inputs synchronously, using the model set with WithEmbeddingModel.
+// The returned vectors are in the order of the inputs.
+// If the estimated cost crosses the budget set by WithBudget, ErrBudgetExceeded is returned.
+func (g *Gpt) Embed(ctx context.Context, inputs ...string) ([][]float32, goerror.TraceableError) {
+	if len(inputs) == 0 {
+		return nil, nil
+	}
+
+	estimate := lineEstimate{model: g.embeddingModel}
+	for _, input := range inputs {
+		estimate.inputTokens += g.countTokens(g.embeddingModel, input)
+	}
+	estimated, err := g.prices.estimateCost(estimate, false, g.budget)
+	if err != nil {
+		return nil, err
+	}
+	if err := reserve(estimated, g.budget); err != nil {
+		return nil, err
+	}
+
+	resp, err := createEmbeddings(ctx, g.client, gptEmbeddingRequest{Model: g.embeddingModel, Input: inputs})
+	if err != nil {
+		g.budget.adjust(estimated, 0)
+		return nil, err
+	}
+	estimate.inputTokens = resp.Usage.PromptTokens
+	actual, _ := g.prices.estimateCost(estimate, false)
+	g.budget.adjust(estimated, actual)
+
+	vectors, vErr := resp.vectors()
+	if vErr != nil {
+		return nil, ErrEmbed.WithError(vErr).WithOrigin()
+	}
+	return vectors, nil
+}
+
+// GptEmbeddingBatchSession batches embedding requests to /v1/embeddings.
+// It behaves like GptBatchSession, but results are looked up by custom_id instead of the line index.
+type GptEmbeddingBatchSession struct {
+	session *GptBatchSession
+	model   string
+}
+
+// NewEmbeddingBatchSession creates a session for embeddings.
+// WithBatchEndpoint is ignored, the session always targets /v1/embeddings.
+// If the options are invalid, ErrInvalidSessionOption is returned.
+func (g *Gpt) NewEmbeddingBatchSession(opts ...BatchSessionOption) (*GptEmbeddingBatchSession, goerror.TraceableError) {
+	session, err := g.NewBatchSession(append(opts, WithBatchEndpoint(EndpointEmbeddings))...)
+	if err != nil {
+		return nil, err
+	}
+	return &GptEmbeddingBatchSession{session: session, model: g.embeddingModel}, nil
+}
+
+// AddToBatch adds a single input to embed to the current batch data.
+// The customRequestId is used to identify the vector in the results, the same rules as for GptBatchSession.AddToBatch apply.
+// If the batch data exceeds the file limits, ErrExceedsFileLimit is returned.
+func (s *GptEmbeddingBatchSession) AddToBatch(customRequestId, input string) goerror.TraceableError {
+	req := gptBatchSingleRequest{
+		CustomId: customRequestId,
+		Method:   "POST",
+		Url:      EndpointEmbeddings,
+		Body:     gptEmbeddingRequest{Model: s.model, Input: []string{input}},
+	}
+	estimate := lineEstimate{model: s.model, inputTokens: s.session.countTokens(s.model, input)}
+	return s.session.addLine(req, estimate)
+}
+
+// CreateBatch creates a new batch with the current batch data, see GptBatchSession.CreateBatch.
+func (s *GptEmbeddingBatchSession) CreateBatch(ctx context.Context, batchName string, options ...CreateBatchOption) (string, goerror.TraceableError) {
+	return s.session.CreateBatch(ctx, batchName, options...)
+}
+
+// RetrieveEmbeddings retrieves all vectors of a completed batch by their custom_id.
+// If the batch is not completed yet, ErrBatchNotCompleted is returned.
+// Lines that failed are skipped, RetrieveEmbedding reports their error.
+func (s *GptEmbeddingBatchSession) RetrieveEmbeddings(ctx context.Context, batchId string) (map[string][]float32, goerror.TraceableError) {
+	file, err := s.session.getOutputFile(ctx, batchId)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string][]float32)
+	for _, line := range bytes.Split(file, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		customId, vector, err := parseEmbeddingLine(line)
+		if err != nil {
+			continue
+		}
+		result[customId] = vector
+	}
+	return result, nil
+}
+
+// RetrieveEmbedding retrieves the vector of a single request by its custom_id.
+func (s *GptEmbeddingBatchSession) RetrieveEmbedding(ctx context.Context, batchId, customRequestId string) ([]float32, goerror.TraceableError) {
+	file, err := s.session.getOutputFile(ctx, batchId)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, line := range bytes.Split(file, []byte("\n")) {
+		// the custom_id may be escaped in the JSON, so compare it decoded before parsing the whole vector
+		var id struct {
+			CustomId string `json:"custom_id"`
+		}
+		if json.Unmarshal(line, &id) != nil || id.CustomId != customRequestId {
+			continue
+		}
+		_, vector, err := parseEmbeddingLine(line)
+		if err != nil {
+			return nil, ErrParseBatchLine.WithError(err).WithOrigin()
+		}
+		return vector, nil
+	}
+	return nil, ErrParseBatchLine.WithError(fmt.Errorf("no result for custom_id %q", customRequestId)).WithOrigin()
+}
+
+func parseEmbeddingLine(line []byte) (string, []float32, error) {
+	var response gptBatchSingleResponse
+	if err := json.Unmarshal(line, &response); err != nil {
+		return "", nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if err := response.err(); err != nil {
+		return response.CustomId, nil, err
+	}
+
+	var body gptEmbeddingResponse
+	if err := json.Unmarshal(response.Response.Body, &body); err != nil {
+		return response.CustomId, nil, fmt.Errorf("failed to decode response body: %w", err)
+	}
+	vectors, err := body.vectors()
+	if err != nil {
+		return response.CustomId, nil, err
+	}
+	if len(vectors) == 0 {
+		return response.CustomId, nil, fmt.Errorf("no embedding in response")
+	}
+	return response.CustomId, vectors[0], nil
+}
@@ -0,0 +1,111 @@
+package gpt
+
+import (
+	"encoding/json"
+	"sort"
+	"unicode/utf8"
+)
+
+// TokenCounter returns the number of tokens text has for the given model.
+type TokenCounter func(model, text string) int
+
+// EstimateTokens is a TokenCounter using the rule of thumb of about four characters per token for english text.
+// It is cheaper than tokenizer.Count, but can be far off for other languages or code.
+func EstimateTokens(model, text string) int {
+	return (utf8.RuneCountInString(text) + 3) / 4
+}
+
+// WithTokenCounter sets the TokenCounter used to estimate the input tokens of each request, defaults to tokenizer.Count.
+var WithTokenCounter = func(counter TokenCounter) BatchSessionOption {
+	return func(s *GptBatchSession) {
+		if counter != nil {
+			s.countTokens = counter
+		}
+	}
+}
+
+// tokens the chat format adds per message and to prime the reply
+const (
+	tokensPerMessage = 3
+	tokensPerReply   = 3
+)
+
+// lineEstimate is the estimated size of a single request of a session.
+type lineEstimate struct {
+	model           string
+	inputTokens     int
+	maxOutputTokens int // 0 if unbounded
+}
+
+// estimateRequest estimates the input tokens of a completion request, including the schemas sent along.
+func estimateRequest(countTokens TokenCounter, opts *appliedRequestOption, systemPrompt, userPrompt string) lineEstimate {
+	tokens := countTokens(opts.model, systemPrompt) + countTokens(opts.model, userPrompt) + 2*tokensPerMessage + tokensPerReply
+	if opts.responseFormat.JsonSchema != nil {
+		schema, _ := json.Marshal(opts.responseFormat.JsonSchema.Schema)
+		tokens += countTokens(opts.model, string(schema))
+	}
+	if opts.tools != nil {
+		tools, _ := json.Marshal(opts.tools.definitions())
+		tokens += countTokens(opts.model, string(tools))
+	}
+	return lineEstimate{model: opts.model, inputTokens: tokens, maxOutputTokens: opts.maxTokens}
+}
+
+// estimateBody estimates a request body read back from a batch input file.
+// The whole body counts as input, which slightly overestimates the prompt.
+func estimateBody(countTokens TokenCounter, body json.RawMessage) lineEstimate {
+	var fields struct {
+		Model               string `json:"model"`
+		MaxCompletionTokens int    `json:"max_completion_tokens"`
+		MaxOutputTokens     int    `json:"max_output_tokens"`
+		MaxTokens           int    `json:"max_tokens"`
+	}
+	_ = json.Unmarshal(body, &fields)
+	return lineEstimate{
+		model:           fields.Model,
+		inputTokens:     countTokens(fields.Model, string(body)),
+		maxOutputTokens: max(fields.MaxCompletionTokens, fields.MaxOutputTokens, fields.MaxTokens),
+	}
+}
+
+// GptEstimate is the projected size and cost of a session before it is submitted.
+type GptEstimate struct {
+	Requests        int
+	InputTokens     int
+	MaxOutputTokens int
+	// UnboundedRequests is the number of requests without WithMaxTokens, their output is not part of the estimate.
+	UnboundedRequests int
+	Models            []string
+	// Cost is the projected cost in USD at batch prices, assuming every request uses its max output tokens.
+	Cost     float64
+	Unpriced []string
+}
+
+// Estimate projects tokens and cost of the current batch data at batch prices, using the table set by WithPriceTable.
+// Input tokens are counted with the TokenCounter set by WithTokenCounter, the output is bounded by WithMaxTokens.
+func (s *GptBatchSession) Estimate() GptEstimate {
+	estimate := GptEstimate{Requests: len(s.estimates)}
+
+	perModel := make(map[string]GptUsage)
+	for _, line := range s.estimates {
+		estimate.InputTokens += line.inputTokens
+		estimate.MaxOutputTokens += line.maxOutputTokens
+		if line.maxOutputTokens == 0 && s.endpoint != EndpointEmbeddings {
+			estimate.UnboundedRequests++
+		}
+		perModel[line.model] = perModel[line.model].add(GptUsage{PromptTokens: line.inputTokens, CompletionTokens: line.maxOutputTokens})
+	}
+
+	for model, usage := range perModel {
+		estimate.Models = append(estimate.Models, model)
+		price, ok := s.prices.Lookup(model)
+		if !ok {
+			estimate.Unpriced = append(estimate.Unpriced, model)
+			continue
+		}
+		estimate.Cost += price.Cost(usage, true)
+	}
+	sort.Strings(estimate.Models)
+	sort.Strings(estimate.Unpriced)
+	return estimate
+}
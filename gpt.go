@@ -6,18 +6,24 @@ import (
 	"net/http"
 
 	"github.com/FrauElster/goerror"
+	"github.com/FrauElster/gogpt/tokenizer"
 )
 
 var ErrGptAsk = goerror.New("gpt_ask", "Error while asking GPT")
 var ErrInvalidContent = goerror.New("invalid_content", "Invalid content")
 
 type Gpt struct {
-	token string
-	model string
-	seed  int // https://platform.openai.com/docs/guides/text-generation/reproducible-outputs
-
-	cacheDir string
-	client   *http.Client
+	token          string
+	model          string
+	embeddingModel string
+	seed           int // https://platform.openai.com/docs/guides/text-generation/reproducible-outputs
+
+	cacheDir    string
+	client      *http.Client
+	backoff     *BackoffRoundTripper
+	prices      PriceTable
+	countTokens TokenCounter
+	budget      *budget
 }
 
 type Option func(*Gpt)
@@ -29,8 +35,24 @@ var WithModel = func(model string) Option {
 		}
 	}
 }
+var WithEmbeddingModel = func(model string) Option {
+	return func(g *Gpt) {
+		if model != "" {
+			g.embeddingModel = model
+		}
+	}
+}
 var WithCacheDir = func(cacheDir string) Option { return func(g *Gpt) { g.cacheDir = cacheDir } }
 
+// WithPriceTable sets the prices used for cost reports, defaults to DefaultPriceTable.
+var WithPriceTable = func(prices PriceTable) Option {
+	return func(g *Gpt) {
+		if prices != nil {
+			g.prices = prices
+		}
+	}
+}
+
 func NewGpt(token string, opts ...Option) (*Gpt, error) {
 	gzipTransport := &GzipRoundTripper{Transport: http.DefaultTransport}
 	headerTransport := &HeaderRoundTripper{
@@ -43,10 +65,14 @@ func NewGpt(token string, opts ...Option) (*Gpt, error) {
 	backOffTransport := NewBackoffRoundTripper(headerTransport)
 
 	gpt := &Gpt{
-		token:  token,
-		model:  "gpt-4o-mini",
-		seed:   420,
-		client: &http.Client{Transport: backOffTransport},
+		token:          token,
+		model:          "gpt-4o-mini",
+		embeddingModel: "text-embedding-3-small",
+		seed:           420,
+		client:         &http.Client{Transport: backOffTransport},
+		backoff:        backOffTransport,
+		prices:         DefaultPriceTable,
+		countTokens:    tokenizer.Count,
 	}
 
 	for _, opt := range opts {
@@ -56,34 +82,93 @@ func NewGpt(token string, opts ...Option) (*Gpt, error) {
 	return gpt, nil
 }
 
-func (g *Gpt) NewBatchSession() *GptBatchSession {
-	return &GptBatchSession{
-		seed:            g.seed,
-		model:           g.model,
-		client:          g.client,
-		batches:         make(map[string]GptBatchResponse),
-		files:           make(map[string][]byte),
-		cacheDir:        g.cacheDir,
-		createBatchData: make([]byte, 0),
+var ErrInvalidSessionOption = goerror.New("gpt:invalid_session_option", "Invalid batch session option")
+
+// NewBatchSession creates a session collecting requests for a batch.
+// If the options are invalid, ErrInvalidSessionOption is returned.
+func (g *Gpt) NewBatchSession(opts ...BatchSessionOption) (*GptBatchSession, goerror.TraceableError) {
+	session := &GptBatchSession{
+		seed:             g.seed,
+		model:            g.model,
+		endpoint:         EndpointChatCompletions,
+		completionWindow: "24h",
+		client:           g.client,
+		backoff:          g.backoff,
+		batches:          make(map[string]GptBatchResponse),
+		files:            make(map[string][]byte),
+		cacheDir:         g.cacheDir,
+		prices:           g.prices,
+		createBatchData:  make([]byte, 0),
+		countTokens:      g.countTokens,
+		gptBudget:        g.budget,
+	}
+
+	for _, opt := range opts {
+		opt(session)
+	}
+	if !SliceContains(supportedEndpoints, session.endpoint) {
+		err := fmt.Errorf("endpoint %q is not one of %v", session.endpoint, supportedEndpoints)
+		return nil, ErrInvalidSessionOption.WithError(err).WithOrigin()
 	}
+	if !SliceContains(supportedCompletionWindows, session.completionWindow) {
+		err := fmt.Errorf("completion window %q is not one of %v", session.completionWindow, supportedCompletionWindows)
+		return nil, ErrInvalidSessionOption.WithError(err).WithOrigin()
+	}
+
+	return session, nil
 }
 
 func (g *Gpt) RetrieveBatch(ctx context.Context, batchId string) (GptBatchResponse, goerror.TraceableError) {
 	return retrieveBatch(ctx, g.client, batchId)
 }
 
-func (g *Gpt) RetrieveBatches(ctx context.Context, stati ...GptBatchStatus) ([]GptBatchResponse, goerror.TraceableError) {
+type RetrieveBatchesOption func(*batchFilter)
+
+type batchFilter struct {
+	stati    []GptBatchStatus
+	metadata map[string]string
+}
+
+// WithStatus keeps the batches having any of the given stati.
+var WithStatus = func(stati ...GptBatchStatus) RetrieveBatchesOption {
+	return func(f *batchFilter) { f.stati = append(f.stati, stati...) }
+}
+
+// WithMetadata keeps the batches whose metadata contains every given key/value pair, see WithBatchMetadata.
+var WithMetadata = func(metadata map[string]string) RetrieveBatchesOption {
+	return func(f *batchFilter) {
+		if f.metadata == nil {
+			f.metadata = make(map[string]string, len(metadata))
+		}
+		for key, value := range metadata {
+			f.metadata[key] = value
+		}
+	}
+}
+
+func (f batchFilter) matches(batch GptBatchResponse) bool {
+	if len(f.stati) > 0 && !SliceContains(f.stati, GptBatchStatus(batch.Status)) {
+		return false
+	}
+	for key, value := range f.metadata {
+		if actual, ok := batch.Metadata[key]; !ok || actual != value {
+			return false
+		}
+	}
+	return true
+}
+
+// RetrieveBatches retrieves all batches, filtered by WithStatus and WithMetadata.
+func (g *Gpt) RetrieveBatches(ctx context.Context, opts ...RetrieveBatchesOption) ([]GptBatchResponse, goerror.TraceableError) {
 	batches, err := retrieveBatches(ctx, g.client)
 	if err != nil {
 		return nil, err
 	}
-	if len(stati) == 0 {
-		return batches, nil
+	var filter batchFilter
+	for _, opt := range opts {
+		opt(&filter)
 	}
-	batches = FilterSlice(batches, func(batch GptBatchResponse) bool {
-		return SliceContains(stati, GptBatchStatus(batch.Status))
-	})
-	return batches, nil
+	return FilterSlice(batches, filter.matches), nil
 }
 
 func (g *Gpt) CancelBatch(ctx context.Context, batchId string) goerror.TraceableError {
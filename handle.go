@@ -0,0 +1,149 @@
+package gpt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/FrauElster/goerror"
+)
+
+var ErrInvalidHandle = goerror.New("gpt:invalid_handle", "Invalid batch handle")
+
+// Handle references a single request added with GptBatchSession.AddToBatch.
+// It gets its batch id once the session creates the batch, from then on it can be stored with String
+// and restored with GptBatchSession.ParseHandle.
+// Handles of a session can be resolved concurrently, but not while the session creates a batch.
+// The output of a batch is downloaded and parsed once per session, so resolve many handles with the same session.
+type Handle struct {
+	session  *GptBatchSession
+	batchId  string
+	customId string
+}
+
+// BatchId returns the id of the batch the request is part of, or "" if the batch was not created yet.
+func (h *Handle) BatchId() string {
+	return h.batchId
+}
+
+// CustomId returns the custom_id of the request.
+func (h *Handle) CustomId() string {
+	return h.customId
+}
+
+// String returns the handle as "<batchId>:<customId>".
+func (h *Handle) String() string {
+	return h.batchId + ":" + h.customId
+}
+
+// ParseHandle restores a handle from its String representation, retrieving its result with this session.
+func (s *GptBatchSession) ParseHandle(str string) (*Handle, goerror.TraceableError) {
+	batchId, customId, ok := strings.Cut(str, ":")
+	if !ok || batchId == "" || customId == "" {
+		return nil, ErrInvalidHandle.WithError(fmt.Errorf("expected <batchId>:<customId>, got %q", str)).WithOrigin()
+	}
+	return &Handle{session: s, batchId: batchId, customId: customId}, nil
+}
+
+// Result returns the completion of the request.
+// If the batch is not completed yet, ErrBatchNotCompleted is returned and Result can be called again later.
+// If the batch failed, expired or was cancelled, ErrBatchFailed is returned.
+func (h *Handle) Result(ctx context.Context) (GptCompletion, goerror.TraceableError) {
+	if h.batchId == "" {
+		return GptCompletion{}, ErrInvalidHandle.WithError(fmt.Errorf("batch of %q was not created yet", h.customId)).WithOrigin()
+	}
+	completions, errs, err := h.session.pollBatchedCompletions(ctx, h.batchId)
+	if err != nil {
+		return GptCompletion{}, err
+	}
+	return handleResult(completions, errs, h)
+}
+
+// AwaitHandles polls the batches of the handles every pollInterval until all of them are done,
+// and returns the completions and errors in the order of the handles.
+// Handles whose batch failed get ErrBatchFailed, the others are not affected.
+// If ctx is done first, the results retrieved so far are returned with ErrBatchNotCompleted.
+func AwaitHandles(ctx context.Context, handles []*Handle, pollInterval time.Duration) ([]GptCompletion, []error, goerror.TraceableError) {
+	completions := make([]GptCompletion, len(handles))
+	errs := make([]error, len(handles))
+
+	// handles by batch, every batch output is parsed once
+	pending := make(map[string][]int)
+	for i, h := range handles {
+		if h.batchId == "" {
+			errs[i] = ErrInvalidHandle.WithError(fmt.Errorf("batch of %q was not created yet", h.customId)).WithOrigin()
+			continue
+		}
+		pending[h.batchId] = append(pending[h.batchId], i)
+	}
+
+	for {
+		for batchId, idxs := range pending {
+			batchCompletions, batchErrs, err := handles[idxs[0]].session.pollBatchedCompletions(ctx, batchId)
+			if errors.Is(err, ErrBatchNotCompleted) {
+				continue
+			}
+			if err != nil && !errors.Is(err, ErrBatchFailed) {
+				return completions, errs, err
+			}
+			for _, i := range idxs {
+				if err != nil {
+					errs[i] = err
+					continue
+				}
+				completion, lineErr := handleResult(batchCompletions, batchErrs, handles[i])
+				completions[i] = completion
+				if lineErr != nil {
+					errs[i] = lineErr
+				}
+			}
+			delete(pending, batchId)
+		}
+		if len(pending) == 0 {
+			return completions, errs, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return completions, errs, ErrBatchNotCompleted.WithError(ctx.Err()).WithOrigin()
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+func handleResult(completions map[string]GptCompletion, errs map[string]error, h *Handle) (GptCompletion, goerror.TraceableError) {
+	if lineErr, ok := errs[h.customId]; ok {
+		return GptCompletion{}, ErrParseBatchLine.WithError(lineErr).WithOrigin()
+	}
+	completion, ok := completions[h.customId]
+	if !ok {
+		return GptCompletion{}, ErrParseBatchLine.WithError(fmt.Errorf("no result for custom_id %q in batch %s", h.customId, h.batchId)).WithOrigin()
+	}
+	return completion, nil
+}
+
+// pollBatchedCompletions works like retrieveBatchedCompletions, but retrieves the status again
+// if the session cached it while the batch was running. Expired and cancelled batches are reported as ErrBatchFailed.
+func (s *GptBatchSession) pollBatchedCompletions(ctx context.Context, batchId string) (map[string]GptCompletion, map[string]error, goerror.TraceableError) {
+	batch, err := s.refreshBatch(ctx, batchId)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch batch.Status {
+	case BatchStatusExpired, BatchStatusCancelled:
+		return nil, nil, ErrBatchFailed.WithError(fmt.Errorf("batch %s is %s", batchId, batch.Status)).WithOrigin()
+	}
+	return s.retrieveBatchedCompletions(ctx, batchId)
+}
+
+// refreshBatch works like getBatch, but retrieves the status again if the session cached it while the batch was running.
+func (s *GptBatchSession) refreshBatch(ctx context.Context, batchId string) (GptBatchResponse, goerror.TraceableError) {
+	s.cacheMu.Lock()
+	if batch, ok := s.batches[batchId]; ok && !batch.Status.done() {
+		delete(s.batches, batchId)
+	}
+	s.cacheMu.Unlock()
+	return s.getBatch(ctx, batchId)
+}
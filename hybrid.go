@@ -0,0 +1,255 @@
+package gpt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/FrauElster/goerror"
+)
+
+var ErrHybrid = goerror.New("gpt:hybrid", "Hybrid execution failed")
+
+type HybridOptions struct {
+	// Name names the batches, it should be unique to the application.
+	Name string
+	// Cutoff is the time before the deadline at which unfinished batches are cancelled
+	// and their remaining requests are sent synchronously, defaults to 30 minutes.
+	// It has to leave time for the cancellation and the synchronous requests.
+	Cutoff time.Duration
+	// CancelTimeout is how long the cancelled batches are waited for, so the requests they completed meanwhile
+	// are not sent again, defaults to a third of Cutoff. Requests of batches still cancelling then are sent anyway.
+	CancelTimeout time.Duration
+	// PollInterval is the interval the batches are polled at, defaults to one minute.
+	PollInterval time.Duration
+	// Concurrency is the maximum number of synchronous requests sent at once, defaults to 8, see AskMany.
+	Concurrency int
+	// SessionOptions are applied to every batch session.
+	SessionOptions []BatchSessionOption
+}
+
+// HybridResult holds the results of RunHybrid in the order of the requests.
+// Completions[i] is only valid if Errors[i] is nil.
+type HybridResult struct {
+	Completions []GptCompletion
+	Errors      []error
+	// Batched is the number of requests answered by a batch, the others were sent synchronously.
+	Batched int
+	// Cancelled are the batches that were still being cancelled when the synchronous requests were sent,
+	// see ReconcileHybrid.
+	Cancelled []string
+}
+
+// RunHybrid sends the requests as batches and waits for them until the cutoff before the deadline.
+// Batches still running then are cancelled and waited for up to the CancelTimeout, collecting what they completed.
+// The requests without a result, including those of failed and cancelled batches, are then sent synchronously
+// with AskMany, bounded by the deadline. Requests the batch answered with an error are not retried.
+// Results of batches that were still cancelling can be taken over later with ReconcileHybrid.
+// If waiting for or reading the batches fails, they are cancelled before the error is returned.
+func (g *Gpt) RunHybrid(ctx context.Context, requests []GptRequest, deadline time.Time, opts HybridOptions) (*HybridResult, goerror.TraceableError) {
+	if opts.Name == "" {
+		return nil, ErrHybrid.WithError(errors.New("name must not be empty")).WithOrigin()
+	}
+	if opts.Cutoff == 0 {
+		opts.Cutoff = 30 * time.Minute
+	}
+	if opts.CancelTimeout == 0 {
+		opts.CancelTimeout = opts.Cutoff / 3
+	}
+	if opts.PollInterval == 0 {
+		opts.PollInterval = time.Minute
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 8
+	}
+
+	batches, err := g.submitBatches(ctx, opts.Name, requests, opts.SessionOptions...)
+	if err != nil {
+		g.cancelBatches(ctx, batches)
+		return nil, err
+	}
+
+	// nobody could collect the batches after an error, do not pay for them
+	fail := func(err goerror.TraceableError) (*HybridResult, goerror.TraceableError) {
+		g.cancelBatches(ctx, batches)
+		return nil, err
+	}
+
+	session, err := g.NewBatchSession(opts.SessionOptions...)
+	if err != nil {
+		return fail(err)
+	}
+	cancelAt := deadline.Add(-opts.Cutoff)
+	cancelled, err := g.awaitOrCancelBatches(ctx, session, batches, cancelAt, cancelAt.Add(opts.CancelTimeout), opts.PollInterval)
+	if err != nil {
+		return fail(err)
+	}
+
+	result := &HybridResult{Completions: make([]GptCompletion, len(requests)), Errors: make([]error, len(requests)), Cancelled: cancelled}
+	answered := make(map[string]bool, len(requests))
+	completions := make(map[string]GptCompletion, len(requests))
+	errs := make(map[string]error)
+	for _, batch := range batches {
+		batchCompletions, batchErrs, err := session.retrievePartialCompletions(ctx, batch.BatchId)
+		if errors.Is(err, ErrBatchNotCompleted) {
+			// still being cancelled, its requests are sent synchronously
+			continue
+		}
+		if err != nil {
+			return fail(err)
+		}
+		for customId, completion := range batchCompletions {
+			completions[customId] = completion
+			answered[customId] = true
+		}
+		for customId, lineErr := range batchErrs {
+			errs[customId] = lineErr
+			answered[customId] = true
+		}
+	}
+
+	remaining := make([]int, 0)
+	for i, req := range requests {
+		if !answered[req.CustomId] {
+			remaining = append(remaining, i)
+			continue
+		}
+		result.Batched++
+		if lineErr, ok := errs[req.CustomId]; ok {
+			result.Errors[i] = ErrParseBatchLine.WithError(lineErr).WithOrigin()
+			continue
+		}
+		result.Completions[i] = completions[req.CustomId]
+	}
+
+	syncCtx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+	syncCompletions, syncErrs := g.AskMany(syncCtx, MapSlice(remaining, func(i int) GptRequest { return requests[i] }), opts.Concurrency)
+	for j, i := range remaining {
+		result.Completions[i] = syncCompletions[j]
+		result.Errors[i] = syncErrs[j]
+	}
+	return result, nil
+}
+
+// ReconcileHybrid waits for the batches RunHybrid cancelled and takes over the results they completed
+// for requests whose synchronous request failed. Only PollInterval and SessionOptions of opts are used.
+// The requests have to be the ones passed to RunHybrid.
+func (g *Gpt) ReconcileHybrid(ctx context.Context, requests []GptRequest, result *HybridResult, opts HybridOptions) goerror.TraceableError {
+	if opts.PollInterval == 0 {
+		opts.PollInterval = time.Minute
+	}
+	if len(requests) != len(result.Errors) {
+		return ErrHybrid.WithError(fmt.Errorf("got %d requests for %d results", len(requests), len(result.Errors))).WithOrigin()
+	}
+
+	session, err := g.NewBatchSession(opts.SessionOptions...)
+	if err != nil {
+		return err
+	}
+	for len(result.Cancelled) > 0 {
+		batchId := result.Cancelled[0]
+		batchCompletions, _, err := session.retrievePartialCompletions(ctx, batchId)
+		if errors.Is(err, ErrBatchNotCompleted) {
+			select {
+			case <-ctx.Done():
+				return ErrBatchNotCompleted.WithError(ctx.Err()).WithOrigin()
+			case <-time.After(opts.PollInterval):
+				if _, err := session.refreshBatch(ctx, batchId); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		for i, req := range requests {
+			completion, ok := batchCompletions[req.CustomId]
+			if !ok || result.Errors[i] == nil {
+				continue
+			}
+			result.Completions[i] = completion
+			result.Errors[i] = nil
+			result.Batched++
+		}
+		result.Cancelled = result.Cancelled[1:]
+	}
+	return nil
+}
+
+// awaitOrCancelBatches polls the batches until they are done.
+// At cancelAt it cancels the running batches, and at stopAt it stops waiting for their cancellation
+// and returns the batches still running.
+func (g *Gpt) awaitOrCancelBatches(ctx context.Context, session *GptBatchSession, batches []submittedBatch, cancelAt, stopAt time.Time, pollInterval time.Duration) ([]string, goerror.TraceableError) {
+	cancelled := make(map[string]bool)
+	for {
+		running := make([]string, 0)
+		for _, batch := range batches {
+			status, err := session.refreshBatch(ctx, batch.BatchId)
+			if err != nil {
+				return nil, err
+			}
+			if !status.Status.done() {
+				running = append(running, batch.BatchId)
+			}
+		}
+		if len(running) == 0 {
+			return nil, nil
+		}
+		if !time.Now().Before(stopAt) {
+			return running, nil
+		}
+
+		if !time.Now().Before(cancelAt) {
+			for _, batchId := range running {
+				if cancelled[batchId] {
+					continue
+				}
+				if err := cancelBatch(ctx, g.client, batchId); err != nil {
+					return nil, err
+				}
+				cancelled[batchId] = true
+			}
+		}
+
+		wait := min(pollInterval, time.Until(stopAt))
+		if untilCancel := time.Until(cancelAt); untilCancel > 0 {
+			wait = min(wait, untilCancel)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ErrBatchNotCompleted.WithError(ctx.Err()).WithOrigin()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// retrievePartialCompletions works like retrieveBatchedCompletions,
+// but also returns the requests expired and cancelled batches completed before they stopped.
+// Failed batches have no results.
+func (s *GptBatchSession) retrievePartialCompletions(ctx context.Context, batchId string) (map[string]GptCompletion, map[string]error, goerror.TraceableError) {
+	batch, err := s.getBatch(ctx, batchId)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch batch.Status {
+	case BatchStatusComplete:
+		return s.retrieveBatchedCompletions(ctx, batchId)
+	case BatchStatusExpired, BatchStatusCancelled:
+		if batch.OutputFileID == nil {
+			return nil, nil, nil
+		}
+		file, err := s.getFile(ctx, *batch.OutputFileID)
+		if err != nil {
+			return nil, nil, err
+		}
+		completions, errs := parseBatchedCompletions(file)
+		return completions, errs, nil
+	case BatchStatusFailed:
+		return nil, nil, nil
+	}
+	return nil, nil, ErrBatchNotCompleted.WithError(fmt.Errorf("batch %s is %s", batchId, batch.Status)).WithOrigin()
+}
@@ -0,0 +1,203 @@
+package gpt
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/FrauElster/goerror"
+)
+
+var ErrLocalBatch = goerror.New("gpt:local_batch", "Local batch execution failed")
+
+// ExecuteBatchLocally runs every line of a batch input JSONL, as GptBatchSession.CreateBatch uploads it,
+// against the synchronous endpoint it targets, at most concurrency at once (see AskMany for how it adapts),
+// and writes the results to output in the format of a batch output file, in the order of the input.
+// Requests that could not be sent are written with an error, like the Batch API does.
+// The requests cost the synchronous prices, and are counted against the budget set by WithBudget like Ask,
+// a request that would cross it is written with an error instead of being sent.
+func (g *Gpt) ExecuteBatchLocally(ctx context.Context, input io.Reader, output io.Writer, concurrency int) goerror.TraceableError {
+	b := localBudget{prices: g.prices, countTokens: g.countTokens, budgets: []*budget{g.budget}}
+	return executeBatchLocally(ctx, g.client, g.backoff, b, input, output, concurrency)
+}
+
+// RunLocally executes the batch data of the session with ExecuteBatchLocally instead of creating a batch.
+// The output is registered under a synthetic batch id, which is returned and set on the handles,
+// so RetrieveBatchedRequest, Handle.Result and the like read it as if it came from the Batch API.
+// With a cache directory, the output is persisted and can be retrieved by other sessions too.
+// The requests are counted at synchronous prices, the batch prices reserved by AddToBatch are released after a successful run,
+// so while it runs the budget has to fit both. If the run fails, the session keeps its reservations.
+func (s *GptBatchSession) RunLocally(ctx context.Context, concurrency int) (string, goerror.TraceableError) {
+	if len(s.createBatchData) == 0 {
+		return "", nil
+	}
+
+	var output bytes.Buffer
+	if err := executeBatchLocally(ctx, s.client, s.backoff, s.localBudget(), bytes.NewReader(s.createBatchData), &output, concurrency); err != nil {
+		return "", err
+	}
+	s.releaseEstimates()
+
+	now := time.Now()
+	completedAt := now.Unix()
+	batchId := fmt.Sprintf("local_batch_%d", now.UnixNano())
+	fileId := fmt.Sprintf("local_file_%d", now.UnixNano())
+	batch := GptBatchResponse{
+		ID:               batchId,
+		Object:           "batch",
+		Endpoint:         string(s.endpoint),
+		CompletionWindow: s.completionWindow,
+		Status:           BatchStatusComplete,
+		OutputFileID:     &fileId,
+		CreatedAt:        now.Unix(),
+		CompletedAt:      &completedAt,
+	}
+	batch.RequestCounts.Total = s.requestCount
+	batch.RequestCounts.Completed = s.requestCount
+
+	s.cacheBatch(batch)
+	s.cacheFile(fileId, output.Bytes())
+	if s.cacheDir != "" {
+		if err := os.WriteFile(path.Join(s.cacheDir, fileId+".jsonl"), output.Bytes(), 0644); err != nil {
+			return "", ErrLocalBatch.WithError(err).WithOrigin()
+		}
+		if err := writeJsonFile(path.Join(s.cacheDir, batchId+".json"), batch); err != nil {
+			return "", ErrLocalBatch.WithError(err).WithOrigin()
+		}
+	}
+
+	for _, handle := range s.handles {
+		handle.batchId = batchId
+	}
+	return batchId, nil
+}
+
+func (s *GptBatchSession) localBudget() localBudget {
+	return localBudget{prices: s.prices, countTokens: s.countTokens, budgets: []*budget{s.budget, s.gptBudget}}
+}
+
+func executeBatchLocally(ctx context.Context, c *http.Client, backoff *BackoffRoundTripper, b localBudget, input io.Reader, output io.Writer, concurrency int) goerror.TraceableError {
+	lines, err := readBatchInputLines(input)
+	if err != nil {
+		return err
+	}
+
+	responses := make([]gptBatchSingleResponse, len(lines))
+	limiter := newAdaptiveLimiter(max(concurrency, 1))
+	var wg sync.WaitGroup
+	for i, line := range lines {
+		limiter.acquire()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { limiter.release(backoff.Throttled()) }()
+			id := fmt.Sprintf("local_req_%d", i)
+			estimated, err := b.reserve(line)
+			if err != nil {
+				code := "budget_exceeded"
+				if errors.Is(err, ErrUnpricedModel) {
+					code = "unpriced_model"
+				}
+				// the cause only, the origin of the error means nothing to the reader of the output
+				responses[i] = failedBatchLine(id, line.CustomId, http.StatusBadRequest, code, errors.Unwrap(err))
+				return
+			}
+			responses[i] = executeBatchLine(ctx, c, line)
+			responses[i].ID = id
+			b.adjust(estimated, responses[i])
+		}()
+	}
+	wg.Wait()
+
+	w := bufio.NewWriter(output)
+	for _, response := range responses {
+		serialized, err := json.Marshal(response)
+		if err != nil {
+			return ErrLocalBatch.WithError(err).WithOrigin()
+		}
+		w.Write(serialized)
+		w.WriteByte('\n')
+	}
+	if err := w.Flush(); err != nil {
+		return ErrLocalBatch.WithError(err).WithOrigin()
+	}
+	return nil
+}
+
+// readBatchInputLines reads a batch input JSONL, skipping empty lines.
+func readBatchInputLines(input io.Reader) ([]gptBatchInputLine, goerror.TraceableError) {
+	rawLines, err := readRawLines(input)
+	if err != nil {
+		return nil, ErrLocalBatch.WithError(err).WithOrigin()
+	}
+	lines := make([]gptBatchInputLine, 0, len(rawLines))
+	for i, raw := range rawLines {
+		if len(bytes.TrimSpace(raw)) == 0 {
+			continue
+		}
+		var line gptBatchInputLine
+		if err := json.Unmarshal(raw, &line); err != nil {
+			return nil, ErrParseBatchLine.WithError(fmt.Errorf("line %d: %w", i+1, err)).WithOrigin()
+		}
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
+
+// failedBatchLine is the output line of a request that could not be sent,
+// shaped like the lines of requests the Batch API rejected: the error is in the response body.
+func failedBatchLine(id, customId string, statusCode int, code string, err error) gptBatchSingleResponse {
+	var body gptErrorBody
+	body.Error.Message = err.Error()
+	body.Error.Type = "invalid_request_error"
+	if statusCode >= http.StatusInternalServerError {
+		body.Error.Type = "server_error"
+	}
+	body.Error.Code = &code
+	response := gptBatchSingleResponse{ID: id, CustomId: customId}
+	response.Response.StatusCode = statusCode
+	response.Response.Body, _ = json.Marshal(body)
+	return response
+}
+
+func executeBatchLine(ctx context.Context, c *http.Client, line gptBatchInputLine) gptBatchSingleResponse {
+	response := gptBatchSingleResponse{CustomId: line.CustomId}
+	fail := func(statusCode int, code string, err error) gptBatchSingleResponse {
+		return failedBatchLine("", line.CustomId, statusCode, code, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, line.Method, "https://api.openai.com"+string(line.Url), bytes.NewReader(line.Body))
+	if err != nil {
+		return fail(http.StatusBadRequest, "invalid_request", err)
+	}
+	req.Header = http.Header{"Content-Type": {"application/json"}}
+
+	res, err := c.Do(req)
+	if err != nil {
+		return fail(http.StatusBadGateway, "request_failed", err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return fail(http.StatusBadGateway, "request_failed", err)
+	}
+
+	if !json.Valid(body) {
+		failed := fail(http.StatusBadGateway, "invalid_response", fmt.Errorf("%s: %s", res.Status, body))
+		failed.Response.RequestID = res.Header.Get("X-Request-Id")
+		return failed
+	}
+	response.Response.StatusCode = res.StatusCode
+	response.Response.RequestID = res.Header.Get("X-Request-Id")
+	response.Response.Body = body
+	return response
+}
@@ -0,0 +1,239 @@
+package gpt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/FrauElster/goerror"
+)
+
+var ErrMapReduce = goerror.New("gpt:map_reduce", "Map-reduce failed")
+
+type MapReduceOptions struct {
+	// Name identifies the job. The state is persisted as <Name>.mapreduce.json in the cache directory,
+	// and all batches of the job are named after it.
+	Name string
+	// MapPrompt is the system prompt applied to every chunk.
+	MapPrompt string
+	// ReducePrompt is the system prompt combining partial results, which are passed separated by "---".
+	ReducePrompt string
+	// GroupSize is the number of partial results a single reduce request combines, defaults to 10.
+	GroupSize int
+	// RequestOptions are applied to every map and reduce request, defaults to WithTextResponse().
+	RequestOptions []RequestOption
+	// SkipFailures leaves requests without a result out of the next stage instead of failing Step, see Failed.
+	// Without it, use RetryFailed to submit them again.
+	SkipFailures bool
+}
+
+// MapReduce summarizes many chunks with batches in two stages.
+// The map stage runs one request per chunk, the reduce stage combines GroupSize partial results per request,
+// recursing until a single result remains.
+// The state is persisted after every step, so the process can exit while a batch is running
+// and continue later with a MapReduce of the same name.
+type MapReduce struct {
+	g     *Gpt
+	opts  MapReduceOptions
+	state mapReduceState
+}
+
+type mapReduceState struct {
+	// Level is 0 during the map stage, and counts the reduce stages after it
+	Level   int              `json:"level"`
+	Batches []submittedBatch `json:"batches"`
+	Result  *string          `json:"result,omitempty"`
+	// Failed holds the error of every skipped request by custom_id
+	Failed map[string]string `json:"failed,omitempty"`
+}
+
+// NewMapReduce creates the map-reduce job, or loads its state if it was started before.
+// It requires a cache directory, see WithCacheDir.
+func (g *Gpt) NewMapReduce(opts MapReduceOptions) (*MapReduce, goerror.TraceableError) {
+	if g.cacheDir == "" {
+		return nil, ErrNoCacheDirectory.WithOrigin()
+	}
+	if opts.Name == "" {
+		return nil, ErrMapReduce.WithError(errors.New("name must not be empty")).WithOrigin()
+	}
+	if opts.GroupSize == 0 {
+		opts.GroupSize = 10
+	}
+	if opts.GroupSize < 2 {
+		return nil, ErrMapReduce.WithError(fmt.Errorf("group size must be at least 2, got %d", opts.GroupSize)).WithOrigin()
+	}
+	if opts.RequestOptions == nil {
+		opts.RequestOptions = []RequestOption{WithTextResponse()}
+	}
+
+	m := &MapReduce{g: g, opts: opts}
+	err := readJsonFile(m.filepath(), &m.state)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, ErrMapReduce.WithError(err).WithOrigin()
+	}
+	return m, nil
+}
+
+func (m *MapReduce) filepath() string {
+	return path.Join(m.g.cacheDir, m.opts.Name+".mapreduce.json")
+}
+
+func (m *MapReduce) save() goerror.TraceableError {
+	if err := writeJsonFile(m.filepath(), m.state); err != nil {
+		return ErrMapReduce.WithError(err).WithOrigin()
+	}
+	return nil
+}
+
+// Started reports whether the map stage was submitted.
+func (m *MapReduce) Started() bool {
+	return len(m.state.Batches) > 0 || m.state.Result != nil
+}
+
+// Start submits the map stage, one request per chunk.
+// The chunk ids are used as custom_id and must be unique, see ChunkText.
+func (m *MapReduce) Start(ctx context.Context, chunks []Chunk) goerror.TraceableError {
+	if m.Started() {
+		return ErrMapReduce.WithError(fmt.Errorf("%s was already started", m.opts.Name)).WithOrigin()
+	}
+	if len(chunks) == 0 {
+		return ErrMapReduce.WithError(errors.New("no chunks to map")).WithOrigin()
+	}
+
+	requests := MapSlice(chunks, func(c Chunk) GptRequest {
+		return GptRequest{CustomId: c.Id, SystemPrompt: m.opts.MapPrompt, UserPrompt: c.Text, Options: m.opts.RequestOptions}
+	})
+	batches, err := m.g.submitBatches(ctx, m.opts.Name, requests)
+	if err != nil {
+		m.g.cancelBatches(ctx, batches)
+		return err
+	}
+
+	m.state = mapReduceState{Level: 0, Batches: batches}
+	return m.save()
+}
+
+// Step advances the job if the batches of the current stage are completed.
+// It returns true once the final result is available, see Result.
+// If a batch is still running, it returns false without error, call Step again later.
+// The requests of failed and expired batches count as failed, like single requests that failed,
+// see MapReduceOptions.SkipFailures and RetryFailed.
+func (m *MapReduce) Step(ctx context.Context) (bool, goerror.TraceableError) {
+	if m.state.Result != nil {
+		return true, nil
+	}
+	if !m.Started() {
+		return false, ErrMapReduce.WithError(fmt.Errorf("%s was not started", m.opts.Name)).WithOrigin()
+	}
+
+	completions, errs, err := m.g.collectBatches(ctx, m.state.Batches)
+	if errors.Is(err, ErrBatchNotCompleted) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if len(errs) > 0 && !m.opts.SkipFailures {
+		joined := make([]error, 0, len(errs))
+		for customId, lineErr := range errs {
+			joined = append(joined, fmt.Errorf("%s: %w", customId, lineErr))
+		}
+		err := fmt.Errorf("%d requests failed, retry them with RetryFailed: %w", len(errs), errors.Join(joined...))
+		return false, ErrMapReduce.WithError(err).WithOrigin()
+	}
+
+	// partial results in the order of the chunks, resubmitted requests are part of several batches
+	partials := make([]string, 0, len(completions))
+	seen := make(map[string]bool, len(completions))
+	for _, batch := range m.state.Batches {
+		for _, customId := range batch.CustomIds {
+			completion, ok := completions[customId]
+			if !ok || seen[customId] {
+				continue
+			}
+			seen[customId] = true
+			partials = append(partials, string(completion.Content))
+		}
+	}
+	failed := m.state.Failed
+	for customId, lineErr := range errs {
+		if failed == nil {
+			failed = make(map[string]string, len(errs))
+		}
+		failed[customId] = lineErr.Error()
+	}
+	if len(partials) == 0 {
+		return false, ErrMapReduce.WithError(errors.New("no request of the stage produced a result")).WithOrigin()
+	}
+
+	if len(partials) == 1 {
+		m.state.Result = &partials[0]
+		m.state.Batches = nil
+		m.state.Failed = failed
+		return true, m.save()
+	}
+
+	level := m.state.Level + 1
+	requests := make([]GptRequest, 0, len(partials)/m.opts.GroupSize+1)
+	for start := 0; start < len(partials); start += m.opts.GroupSize {
+		group := partials[start:min(start+m.opts.GroupSize, len(partials))]
+		requests = append(requests, GptRequest{
+			CustomId:     fmt.Sprintf("%s-reduce-%d-%d", m.opts.Name, level, len(requests)),
+			SystemPrompt: m.opts.ReducePrompt,
+			UserPrompt:   strings.Join(group, "\n\n---\n\n"),
+			Options:      m.opts.RequestOptions,
+		})
+	}
+	batches, err := m.g.submitBatches(ctx, m.opts.Name, requests)
+	if err != nil {
+		m.g.cancelBatches(ctx, batches)
+		return false, err
+	}
+
+	m.state = mapReduceState{Level: level, Batches: batches, Failed: failed}
+	return false, m.save()
+}
+
+// RetryFailed submits the requests of the current stage that did not produce a result again,
+// reading them from the input files of their batches. It returns the number of resubmitted requests.
+// If a batch of the stage is still running, ErrBatchNotCompleted is returned.
+func (m *MapReduce) RetryFailed(ctx context.Context) (int, goerror.TraceableError) {
+	if m.state.Result != nil || !m.Started() {
+		return 0, nil
+	}
+	_, errs, err := m.g.collectBatches(ctx, m.state.Batches)
+	if err != nil {
+		return 0, err
+	}
+	if len(errs) == 0 {
+		return 0, nil
+	}
+
+	resubmitted, err := m.g.resubmitFailed(ctx, m.opts.Name, m.state.Batches, errs)
+	if err != nil {
+		return 0, err
+	}
+	m.state.Batches = append(m.state.Batches, resubmitted...)
+	return len(errs), m.save()
+}
+
+// Failed returns the errors of requests that were skipped, see MapReduceOptions.SkipFailures, by custom_id.
+func (m *MapReduce) Failed() map[string]string {
+	return m.state.Failed
+}
+
+// Level returns the current stage, 0 is the map stage and every reduce stage counts up.
+func (m *MapReduce) Level() int {
+	return m.state.Level
+}
+
+// Result returns the final result once Step reported it is done.
+func (m *MapReduce) Result() (string, bool) {
+	if m.state.Result == nil {
+		return "", false
+	}
+	return *m.state.Result, true
+}
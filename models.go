@@ -1,51 +1,168 @@
 package gpt
 
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
 type gptPromptResponse struct {
 	Id      string `json:"id"`
 	Object  string `json:"object"`
 	Created int    `json:"created"`
 	Model   string `json:"model"`
 	Usage   struct {
-		PromptTokens     int `json:"prompt_tokens"`
-		CompletionTokens int `json:"completion_tokens"`
-		TotalTokens      int `json:"total_tokens"`
+		PromptTokens        int `json:"prompt_tokens"`
+		PromptTokensDetails struct {
+			CachedTokens int `json:"cached_tokens"`
+		} `json:"prompt_tokens_details"`
+		CompletionTokens        int `json:"completion_tokens"`
+		CompletionTokensDetails struct {
+			ReasoningTokens int `json:"reasoning_tokens"`
+		} `json:"completion_tokens_details"`
+		TotalTokens int `json:"total_tokens"`
 	} `json:"usage"`
 	Choices []struct {
-		Message struct {
-			Role    string `json:"role"`
-			Content string `json:"content"`
-		} `json:"message"`
-		FinishReason string `json:"finish_reason"`
-		Index        int    `json:"index"`
+		Message      gptMessage `json:"message"`
+		FinishReason string     `json:"finish_reason"`
+		Index        int        `json:"index"`
 	} `json:"choices"`
 }
 
+type gptMessage struct {
+	Role       string        `json:"role"`
+	Content    string        `json:"content"`
+	ToolCalls  []GptToolCall `json:"tool_calls,omitempty"`
+	ToolCallId string        `json:"tool_call_id,omitempty"`
+}
+
+// GptToolCall is a function call requested by the model.
+// Arguments is the raw JSON the model generated, it is not guaranteed to be valid.
+type GptToolCall struct {
+	Id       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+// GptCompletion is the answer of a single chat completion.
+type GptCompletion struct {
+	Model        string
+	Content      []byte
+	ToolCalls    []GptToolCall
+	FinishReason string
+	Usage        GptUsage
+}
+
+// GptUsage counts the tokens of one or more requests.
+// CachedTokens are part of PromptTokens, ReasoningTokens are part of CompletionTokens.
+type GptUsage struct {
+	PromptTokens     int
+	CachedTokens     int
+	CompletionTokens int
+	ReasoningTokens  int
+}
+
+// GptEndpoint is an API endpoint accepted by the Batch API.
+type GptEndpoint string
+
+const (
+	EndpointChatCompletions GptEndpoint = "/v1/chat/completions"
+	EndpointEmbeddings      GptEndpoint = "/v1/embeddings"
+	EndpointResponses       GptEndpoint = "/v1/responses"
+)
+
 type gptBatchSingleRequest struct {
-	CustomId string           `json:"custom_id"`
-	Method   string           `json:"method"`
-	Url      string           `json:"url"`
-	Body     gptPromptRequest `json:"body"`
+	CustomId string      `json:"custom_id"`
+	Method   string      `json:"method"`
+	Url      GptEndpoint `json:"url"`
+	Body     any         `json:"body"`
+}
+
+// gptBatchInputLine is a line of a batch input file as read back, keeping the body as is.
+type gptBatchInputLine struct {
+	CustomId string          `json:"custom_id"`
+	Method   string          `json:"method"`
+	Url      GptEndpoint     `json:"url"`
+	Body     json.RawMessage `json:"body"`
 }
 
 type gptBatchSingleResponse struct {
 	ID       string `json:"id"`
 	CustomId string `json:"custom_id"`
 	Response struct {
-		StatusCode int               `json:"status_code"`
-		RequestID  string            `json:"request_id"`
-		Body       gptPromptResponse `json:"body"`
+		StatusCode int             `json:"status_code"`
+		RequestID  string          `json:"request_id"`
+		Body       json.RawMessage `json:"body"`
 	} `json:"response"`
+	// Error is set if the request could not be sent at all
+	Error *gptBatchLineError `json:"error"`
+}
+
+type gptBatchLineError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// gptErrorBody is the body of a request the API rejected.
+type gptErrorBody struct {
+	Error struct {
+		Message string  `json:"message"`
+		Type    string  `json:"type"`
+		Param   *string `json:"param"`
+		Code    *string `json:"code"`
+	} `json:"error"`
+}
+
+type gptEmbeddingRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type gptEmbeddingResponse struct {
+	Object string `json:"object"`
+	Model  string `json:"model"`
+	Data   []struct {
+		Object    string    `json:"object"`
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+	Usage struct {
+		PromptTokens int `json:"prompt_tokens"`
+		TotalTokens  int `json:"total_tokens"`
+	} `json:"usage"`
 }
 
 type gptPromptRequest struct {
-	Seed     int    `json:"seed,omitempty"`
-	Model    string `json:"model"`
-	Messages []struct {
-		Role    string `json:"role"`
-		Content string `json:"content"`
-	} `json:"messages"`
+	Seed           int               `json:"seed,omitempty"`
+	Model          string            `json:"model"`
+	Messages       []gptMessage      `json:"messages"`
 	Temperature    float64           `json:"temperature"`
 	ResponseFormat gptResponseFormat `json:"response_format"`
+	Tools          []gptTool         `json:"tools,omitempty"`
+	ToolChoice     *gptToolChoice    `json:"tool_choice,omitempty"`
+	MaxTokens      int               `json:"max_completion_tokens,omitempty"`
+}
+
+type gptToolChoice struct {
+	Type     string `json:"type"`
+	Function struct {
+		Name string `json:"name"`
+	} `json:"function"`
+}
+
+type gptTool struct {
+	Type     string                `json:"type"`
+	Function gptFunctionDefinition `json:"function"`
+}
+
+type gptFunctionDefinition struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Parameters  map[string]any `json:"parameters"`
+	Strict      bool           `json:"strict"`
 }
 
 type gptResponseFormat struct {
@@ -59,10 +176,90 @@ type gptJsonSchema struct {
 	Schema map[string]any `json:"schema"`
 }
 
+type gptResponsesRequest struct {
+	Model        string                  `json:"model"`
+	Instructions string                  `json:"instructions,omitempty"`
+	Input        []gptResponsesItem      `json:"input"`
+	Temperature  float64                 `json:"temperature"`
+	Text         gptResponsesText        `json:"text"`
+	Tools        []gptResponsesTool      `json:"tools,omitempty"`
+	ToolChoice   *gptResponsesToolChoice `json:"tool_choice,omitempty"`
+	MaxTokens    int                     `json:"max_output_tokens,omitempty"`
+}
+
+// gptResponsesItem is an input or output item of the Responses API.
+// Depending on the type, only some of the fields are set.
+type gptResponsesItem struct {
+	Type      string `json:"type,omitempty"`
+	Role      string `json:"role,omitempty"`
+	Content   any    `json:"content,omitempty"`
+	CallId    string `json:"call_id,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments,omitempty"`
+	// Output is a pointer, so the empty result of a tool is sent, while other item types leave it out
+	Output *string `json:"output,omitempty"`
+}
+
+type gptResponsesText struct {
+	Format gptResponsesFormat `json:"format"`
+}
+
+type gptResponsesFormat struct {
+	Type   string         `json:"type"`
+	Name   string         `json:"name,omitempty"`
+	Strict bool           `json:"strict,omitempty"`
+	Schema map[string]any `json:"schema,omitempty"`
+}
+
+type gptResponsesTool struct {
+	Type        string         `json:"type"`
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Parameters  map[string]any `json:"parameters"`
+	Strict      bool           `json:"strict"`
+}
+
+type gptResponsesToolChoice struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+}
+
+type gptResponsesResponse struct {
+	Id     string `json:"id"`
+	Object string `json:"object"`
+	Model  string `json:"model"`
+	Status string `json:"status"`
+	Output []struct {
+		Type      string `json:"type"`
+		Role      string `json:"role"`
+		CallId    string `json:"call_id"`
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+		Content   []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"content"`
+	} `json:"output"`
+	IncompleteDetails *struct {
+		Reason string `json:"reason"`
+	} `json:"incomplete_details"`
+	Usage struct {
+		InputTokens        int `json:"input_tokens"`
+		InputTokensDetails struct {
+			CachedTokens int `json:"cached_tokens"`
+		} `json:"input_tokens_details"`
+		OutputTokens        int `json:"output_tokens"`
+		OutputTokensDetails struct {
+			ReasoningTokens int `json:"reasoning_tokens"`
+		} `json:"output_tokens_details"`
+	} `json:"usage"`
+}
+
 type gptBatchRequest struct {
-	InputFileId      string `json:"input_file_id"`
-	Endpoint         string `json:"endpoint"`
-	CompletionWindow string `json:"completion_window"`
+	InputFileId      string            `json:"input_file_id"`
+	Endpoint         GptEndpoint       `json:"endpoint"`
+	CompletionWindow string            `json:"completion_window"`
+	Metadata         map[string]string `json:"metadata,omitempty"`
 }
 
 type GptFilePurpose string
@@ -109,8 +306,21 @@ const (
 	BatchStatusComplete   GptBatchStatus = "completed"
 	BatchStatusFailed     GptBatchStatus = "failed"
 	BatchStatusFinalizing GptBatchStatus = "finalizing"
+	BatchStatusValidating GptBatchStatus = "validating"
+	BatchStatusExpired    GptBatchStatus = "expired"
+	BatchStatusCancelling GptBatchStatus = "cancelling"
+	BatchStatusCancelled  GptBatchStatus = "cancelled"
 )
 
+// done reports whether the batch reached a final status and will not change anymore.
+func (s GptBatchStatus) done() bool {
+	switch s {
+	case BatchStatusComplete, BatchStatusFailed, BatchStatusExpired, BatchStatusCancelled:
+		return true
+	}
+	return false
+}
+
 type GptBatchResponse struct {
 	ID       string `json:"id"`
 	Object   string `json:"object"`
@@ -138,10 +348,69 @@ type GptBatchResponse struct {
 		Completed int `json:"completed"`
 		Failed    int `json:"failed"`
 	} `json:"request_counts"`
-	Metadata struct {
-		CustomerID       string `json:"customer_id"`
-		BatchDescription string `json:"batch_description"`
-	} `json:"metadata"`
+	Metadata           map[string]string `json:"metadata"`
+	Model              string            `json:"model,omitempty"`
+	Usage              *GptBatchUsage    `json:"usage,omitempty"`
+	OutputExpiresAfter *struct {
+		Anchor  string `json:"anchor"`
+		Seconds int64  `json:"seconds"`
+	} `json:"output_expires_after,omitempty"`
+
+	// Raw is the batch object as returned by the API, including fields this library does not know yet.
+	// It is also what gets written to the persistent cache.
+	Raw json.RawMessage `json:"-"`
+}
+
+// GptBatchUsage is the token usage of a whole batch.
+// It is only reported by the API for batches created after usage reporting was introduced.
+type GptBatchUsage struct {
+	InputTokens        int `json:"input_tokens"`
+	InputTokensDetails struct {
+		CachedTokens int `json:"cached_tokens"`
+	} `json:"input_tokens_details"`
+	OutputTokens        int `json:"output_tokens"`
+	OutputTokensDetails struct {
+		ReasoningTokens int `json:"reasoning_tokens"`
+	} `json:"output_tokens_details"`
+	TotalTokens int `json:"total_tokens"`
+}
+
+// UnmarshalJSON decodes the known fields and retains the raw JSON.
+func (b *GptBatchResponse) UnmarshalJSON(data []byte) error {
+	type alias GptBatchResponse
+	var decoded alias
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	*b = GptBatchResponse(decoded)
+	b.Raw = append(json.RawMessage(nil), data...)
+	return nil
+}
+
+// MarshalJSON encodes the known fields into the retained raw JSON, so fields this library does not know are kept
+// while changes to the known ones are not lost. If the batch was not decoded from JSON, only the known fields are encoded.
+func (b GptBatchResponse) MarshalJSON() ([]byte, error) {
+	type alias GptBatchResponse
+	known, err := json.Marshal(alias(b))
+	if err != nil || len(b.Raw) == 0 {
+		return known, err
+	}
+
+	var merged map[string]json.RawMessage
+	if err := json.Unmarshal(b.Raw, &merged); err != nil {
+		return nil, err
+	}
+	// drop the known keys first, omitted ones must not survive from the raw JSON
+	t := reflect.TypeFor[alias]()
+	for i := range t.NumField() {
+		if name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ","); name != "" && name != "-" {
+			delete(merged, name)
+		}
+	}
+	if err := json.Unmarshal(known, &merged); err != nil {
+		return nil, err
+	}
+	return json.Marshal(merged)
 }
 
 type gptFileDeletionResponse struct {
@@ -0,0 +1,225 @@
+package gpt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+
+	"github.com/FrauElster/goerror"
+)
+
+var ErrPipeline = goerror.New("gpt:pipeline", "Pipeline failed")
+
+// PipelineStage is a single stage of a Pipeline.
+type PipelineStage struct {
+	// Name identifies the stage in the checkpoint and names its batches.
+	Name string
+	// Build returns the requests of the stage.
+	// previous holds the answers of the previous stage by custom_id, for the first stage the inputs passed to Start.
+	// Requests that failed in the previous stage are not part of it, see Pipeline.Failed.
+	Build func(ctx context.Context, previous map[string][]byte) ([]GptRequest, error)
+}
+
+// Pipeline chains batches, building the prompts of each stage from the results of the previous one.
+// Its progress is checkpointed in the cache directory after every step,
+// so it can be advanced from cron with Step, without keeping a process alive while batches run.
+type Pipeline struct {
+	g      *Gpt
+	name   string
+	stages []PipelineStage
+	state  pipelineState
+}
+
+type pipelineState struct {
+	// Stages are the stage names the checkpoint was created with
+	Stages  []string         `json:"stages"`
+	Stage   int              `json:"stage"`
+	Batches []submittedBatch `json:"batches"`
+	// Failed holds the error of every request that did not produce a result, by stage and custom_id
+	Failed  map[string]map[string]string `json:"failed,omitempty"`
+	Results map[string]string            `json:"results,omitempty"`
+	Done    bool                         `json:"done"`
+}
+
+// NewPipeline creates the pipeline, or loads its checkpoint if it was started before.
+// The checkpoint is only valid for the same stage names in the same order.
+// It requires a cache directory, see WithCacheDir.
+func (g *Gpt) NewPipeline(name string, stages ...PipelineStage) (*Pipeline, goerror.TraceableError) {
+	if g.cacheDir == "" {
+		return nil, ErrNoCacheDirectory.WithOrigin()
+	}
+	if name == "" {
+		return nil, ErrPipeline.WithError(errors.New("name must not be empty")).WithOrigin()
+	}
+	if len(stages) == 0 {
+		return nil, ErrPipeline.WithError(errors.New("a pipeline needs at least one stage")).WithOrigin()
+	}
+	names := MapSlice(stages, func(s PipelineStage) string { return s.Name })
+	for i, stage := range stages {
+		if stage.Name == "" || stage.Build == nil {
+			return nil, ErrPipeline.WithError(fmt.Errorf("stage %d needs a name and a build function", i)).WithOrigin()
+		}
+		if slices.Index(names, stage.Name) != i {
+			return nil, ErrPipeline.WithError(fmt.Errorf("stage name %q is not unique", stage.Name)).WithOrigin()
+		}
+	}
+
+	p := &Pipeline{g: g, name: name, stages: stages}
+	err := readJsonFile(p.filepath(), &p.state)
+	if errors.Is(err, os.ErrNotExist) {
+		return p, nil
+	}
+	if err != nil {
+		return nil, ErrPipeline.WithError(err).WithOrigin()
+	}
+	if !slices.Equal(p.state.Stages, names) {
+		err := fmt.Errorf("checkpoint has stages %v, pipeline has %v", p.state.Stages, names)
+		return nil, ErrPipeline.WithError(err).WithOrigin()
+	}
+	return p, nil
+}
+
+func (p *Pipeline) filepath() string {
+	return path.Join(p.g.cacheDir, p.name+".pipeline.json")
+}
+
+func (p *Pipeline) save() goerror.TraceableError {
+	if err := writeJsonFile(p.filepath(), p.state); err != nil {
+		return ErrPipeline.WithError(err).WithOrigin()
+	}
+	return nil
+}
+
+// Started reports whether the first stage was submitted.
+func (p *Pipeline) Started() bool {
+	return len(p.state.Stages) > 0
+}
+
+// Start builds and submits the first stage from the inputs.
+// If the submission fails, the batches created so far are cancelled and Start can be called again.
+func (p *Pipeline) Start(ctx context.Context, inputs map[string][]byte) goerror.TraceableError {
+	if p.Started() {
+		return ErrPipeline.WithError(fmt.Errorf("%s was already started", p.name)).WithOrigin()
+	}
+
+	p.state = pipelineState{Stages: MapSlice(p.stages, func(s PipelineStage) string { return s.Name })}
+	if err := p.advance(ctx, inputs); err != nil {
+		p.state = pipelineState{}
+		return err
+	}
+	return nil
+}
+
+// Step advances the pipeline if the batches of the current stage are completed.
+// It returns true once the last stage is done, see Results.
+// If a batch is still running, it returns false without error, call Step again later.
+// Requests without a result, including all requests of failed and expired batches that did not complete,
+// are recorded as failures of the stage (see Failed) and left out of the next one, so such a batch does not stop the pipeline.
+func (p *Pipeline) Step(ctx context.Context) (bool, goerror.TraceableError) {
+	if p.state.Done {
+		return true, nil
+	}
+	if !p.Started() {
+		return false, ErrPipeline.WithError(fmt.Errorf("%s was not started", p.name)).WithOrigin()
+	}
+
+	completions, errs, err := p.g.collectBatches(ctx, p.state.Batches)
+	if errors.Is(err, ErrBatchNotCompleted) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	results := make(map[string][]byte, len(completions))
+	for customId, completion := range completions {
+		results[customId] = completion.Content
+	}
+	p.recordFailures(errs)
+
+	stage := p.state.Stage
+	p.state.Stage++
+	if err := p.advance(ctx, results); err != nil {
+		// stay on the completed stage, so the next Step retries building the following one
+		p.state.Stage = stage
+		return false, err
+	}
+	return p.state.Done, nil
+}
+
+// advance builds and submits the current stage from the results of the previous one.
+// Stages without requests are skipped, after the last stage the results are kept and the pipeline is done.
+func (p *Pipeline) advance(ctx context.Context, previous map[string][]byte) goerror.TraceableError {
+	for ; p.state.Stage < len(p.stages); p.state.Stage++ {
+		stage := p.stages[p.state.Stage]
+		requests, err := stage.Build(ctx, previous)
+		if err != nil {
+			return ErrPipeline.WithError(fmt.Errorf("failed to build stage %s: %w", stage.Name, err)).WithOrigin()
+		}
+		if len(requests) == 0 {
+			previous = map[string][]byte{}
+			continue
+		}
+
+		batches, tErr := p.g.submitBatches(ctx, p.name+"-"+stage.Name, requests)
+		if tErr != nil {
+			// the stage is built again on retry, the batches submitted so far would be paid twice
+			p.g.cancelBatches(ctx, batches)
+			return tErr
+		}
+		p.state.Batches = batches
+		return p.save()
+	}
+
+	p.state.Done = true
+	p.state.Batches = nil
+	p.state.Results = make(map[string]string, len(previous))
+	for customId, result := range previous {
+		p.state.Results[customId] = string(result)
+	}
+	return p.save()
+}
+
+func (p *Pipeline) recordFailures(errs map[string]error) {
+	if len(errs) == 0 {
+		return
+	}
+	if p.state.Failed == nil {
+		p.state.Failed = make(map[string]map[string]string)
+	}
+	stage := p.stages[p.state.Stage].Name
+	if p.state.Failed[stage] == nil {
+		p.state.Failed[stage] = make(map[string]string, len(errs))
+	}
+	for customId, err := range errs {
+		p.state.Failed[stage][customId] = err.Error()
+	}
+}
+
+// Stage returns the name of the stage currently running, or "" once the pipeline is done.
+func (p *Pipeline) Stage() string {
+	if p.state.Done || !p.Started() {
+		return ""
+	}
+	return p.stages[p.state.Stage].Name
+}
+
+// Results returns the answers of the last stage by custom_id, once Step reported the pipeline is done.
+func (p *Pipeline) Results() (map[string][]byte, bool) {
+	if !p.state.Done {
+		return nil, false
+	}
+	results := make(map[string][]byte, len(p.state.Results))
+	for customId, result := range p.state.Results {
+		results[customId] = []byte(result)
+	}
+	return results, true
+}
+
+// Failed returns the errors of requests that did not produce a result, by stage name and custom_id.
+func (p *Pipeline) Failed() map[string]map[string]string {
+	return p.state.Failed
+}
@@ -0,0 +1,181 @@
+package gpt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/FrauElster/goerror"
+)
+
+// WithResponsesApi sends the request to the Responses API (/v1/responses) instead of chat completions.
+// The answer is parsed into the same GptCompletion, so retrieval code does not need to change.
+// The Responses API has no seed, the other request options and the model of the Gpt instance apply as usual.
+// In a batch session, all requests must target the same endpoint, so prefer WithBatchEndpoint(EndpointResponses) on the session.
+var WithResponsesApi = func() RequestOption {
+	return func(a *appliedRequestOption) error {
+		a.endpoint = EndpointResponses
+		return nil
+	}
+}
+
+func createResponse(ctx context.Context, c *http.Client, body gptResponsesRequest) (gptResponsesResponse, goerror.TraceableError) {
+	serializedBody, err := json.Marshal(body)
+	if err != nil {
+		err = fmt.Errorf("failed to serialize body: %w", err)
+		return gptResponsesResponse{}, ErrGptAsk.WithError(err).WithOrigin()
+	}
+
+	url := "https://api.openai.com/v1/responses"
+	req, err := http.NewRequest("POST", url, bytes.NewReader(serializedBody))
+	if err != nil {
+		return gptResponsesResponse{}, ErrGptAsk.WithError(err).WithOrigin()
+	}
+	req = req.WithContext(ctx)
+	req.Header = http.Header{"Content-Type": {"application/json"}}
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return gptResponsesResponse{}, ErrGptAsk.WithError(err).WithOrigin()
+	}
+
+	decodedResponse, err := parseResponse[gptResponsesResponse](resp)
+	if err != nil {
+		return gptResponsesResponse{}, ErrGptAsk.WithError(err).WithOrigin()
+	}
+
+	return decodedResponse, nil
+}
+
+func (a *appliedRequestOption) responsesRequest(systemPrompt, userPrompt string) gptResponsesRequest {
+	req := gptResponsesRequest{
+		Model:        a.model,
+		Instructions: systemPrompt,
+		Input:        []gptResponsesItem{{Role: "user", Content: userPrompt}},
+		Temperature:  0,
+		Text:         gptResponsesText{Format: gptResponsesFormat{Type: a.responseFormat.Type}},
+		MaxTokens:    a.maxTokens,
+	}
+	if a.responseFormat.JsonSchema != nil {
+		req.Text.Format.Name = a.responseFormat.JsonSchema.Name
+		req.Text.Format.Strict = a.responseFormat.JsonSchema.Strict
+		req.Text.Format.Schema = a.responseFormat.JsonSchema.Schema
+	}
+	if a.tools != nil {
+		req.Tools = MapSlice(a.tools.definitions(), func(t gptTool) gptResponsesTool {
+			return gptResponsesTool{
+				Type:        t.Type,
+				Name:        t.Function.Name,
+				Description: t.Function.Description,
+				Parameters:  t.Function.Parameters,
+				Strict:      t.Function.Strict,
+			}
+		})
+	}
+	if a.toolChoice != "" {
+		req.ToolChoice = &gptResponsesToolChoice{Type: "function", Name: a.toolChoice}
+	}
+	return req
+}
+
+// completion converts the output items of the response into a GptCompletion.
+// The finish reason is mapped to the one chat completions would have given.
+func (r gptResponsesResponse) completion() (GptCompletion, error) {
+	completion := GptCompletion{
+		Model: r.Model,
+		Usage: GptUsage{
+			PromptTokens:     r.Usage.InputTokens,
+			CachedTokens:     r.Usage.InputTokensDetails.CachedTokens,
+			CompletionTokens: r.Usage.OutputTokens,
+			ReasoningTokens:  r.Usage.OutputTokensDetails.ReasoningTokens,
+		},
+	}
+
+	var content strings.Builder
+	for _, item := range r.Output {
+		switch item.Type {
+		case "message":
+			for _, c := range item.Content {
+				if c.Type == "output_text" {
+					content.WriteString(c.Text)
+				}
+			}
+		case "function_call":
+			call := GptToolCall{Id: item.CallId, Type: "function"}
+			call.Function.Name = item.Name
+			call.Function.Arguments = item.Arguments
+			completion.ToolCalls = append(completion.ToolCalls, call)
+		}
+	}
+	if content.Len() == 0 && len(completion.ToolCalls) == 0 {
+		return GptCompletion{}, fmt.Errorf("gpt is clueless")
+	}
+	completion.Content = []byte(content.String())
+
+	switch {
+	case r.Status == "incomplete" && r.IncompleteDetails != nil && r.IncompleteDetails.Reason == "content_filter":
+		completion.FinishReason = "content_filter"
+	case r.Status == "incomplete":
+		completion.FinishReason = "length"
+	case len(completion.ToolCalls) > 0:
+		completion.FinishReason = "tool_calls"
+	default:
+		completion.FinishReason = "stop"
+	}
+	return completion, nil
+}
+
+// parseCompletionBody parses the body of a batch output line, which is either a chat completion or a response.
+func parseCompletionBody(body json.RawMessage) (GptCompletion, error) {
+	var head struct {
+		Object string `json:"object"`
+	}
+	if err := json.Unmarshal(body, &head); err != nil {
+		return GptCompletion{}, fmt.Errorf("failed to decode response body: %w", err)
+	}
+
+	if head.Object == "response" {
+		var response gptResponsesResponse
+		if err := json.Unmarshal(body, &response); err != nil {
+			return GptCompletion{}, fmt.Errorf("failed to decode response body: %w", err)
+		}
+		return response.completion()
+	}
+
+	var response gptPromptResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return GptCompletion{}, fmt.Errorf("failed to decode response body: %w", err)
+	}
+	return response.completion()
+}
+
+// responsesConversation is a conversation with the Responses API.
+type responsesConversation struct {
+	req gptResponsesRequest
+}
+
+func (c *responsesConversation) send(ctx context.Context, client *http.Client) (GptCompletion, goerror.TraceableError) {
+	resp, err := createResponse(ctx, client, c.req)
+	if err != nil {
+		return GptCompletion{}, err
+	}
+	completion, cErr := resp.completion()
+	if cErr != nil {
+		return GptCompletion{}, ErrGptAsk.WithError(cErr).WithOrigin()
+	}
+	return completion, nil
+}
+
+func (c *responsesConversation) addToolResults(completion GptCompletion, results []string) {
+	// a forced tool call applies to the first round only, otherwise the model could never answer
+	c.req.ToolChoice = nil
+	for i, call := range completion.ToolCalls {
+		c.req.Input = append(c.req.Input,
+			gptResponsesItem{Type: "function_call", CallId: call.Id, Name: call.Function.Name, Arguments: call.Function.Arguments},
+			gptResponsesItem{Type: "function_call_output", CallId: call.Id, Output: &results[i]},
+		)
+	}
+}
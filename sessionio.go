@@ -0,0 +1,72 @@
+package gpt
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+
+	"github.com/FrauElster/goerror"
+)
+
+var ErrImportBatch = goerror.New("gpt:import_batch", "Failed to import batch input")
+
+// ImportBatchSession creates a session holding the requests of a batch input JSONL, as written by GptBatchSession.Export.
+// The input is checked with ValidateBatchInput first, if it has any problem, ErrImportBatch lists them all and nothing is added.
+// The endpoint of the session is taken from the first line, the estimates count the whole request body as input.
+// Like AddToBatch, the requests are checked against the file limits and the budget,
+// if one of them does not fit, the reservations of the others are released again.
+func (g *Gpt) ImportBatchSession(r io.Reader, opts ...BatchSessionOption) (*GptBatchSession, goerror.TraceableError) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, ErrImportBatch.WithError(err).WithOrigin()
+	}
+	if lineErrs := ValidateBatchInput(bytes.NewReader(data)); len(lineErrs) > 0 {
+		return nil, ErrImportBatch.WithError(errors.Join(MapSlice(lineErrs, func(e LineError) error { return e })...)).WithOrigin()
+	}
+	lines, tErr := readBatchInputLines(bytes.NewReader(data))
+	if tErr != nil {
+		return nil, ErrImportBatch.WithError(tErr).WithOrigin()
+	}
+
+	session, tErr := g.NewBatchSession(opts...)
+	if tErr != nil {
+		return nil, tErr
+	}
+	if len(lines) > 0 {
+		session.endpoint = lines[0].Url
+	}
+	for _, line := range lines {
+		req := gptBatchSingleRequest{CustomId: line.CustomId, Method: line.Method, Url: line.Url, Body: line.Body}
+		if err := session.addLine(req, estimateBody(session.countTokens, line.Body)); err != nil {
+			// the session is dropped, give back what the earlier lines reserved
+			session.releaseEstimates()
+			return nil, err
+		}
+		session.handles = append(session.handles, &Handle{session: session, customId: line.CustomId})
+	}
+	return session, nil
+}
+
+// ImportBatchSessionFile works like ImportBatchSession, reading the JSONL from the file at filepath.
+func (g *Gpt) ImportBatchSessionFile(filepath string, opts ...BatchSessionOption) (*GptBatchSession, goerror.TraceableError) {
+	f, err := os.Open(filepath)
+	if err != nil {
+		return nil, ErrImportBatch.WithError(err).WithOrigin()
+	}
+	defer f.Close()
+	return g.ImportBatchSession(f, opts...)
+}
+
+// Export writes the requests added to the session as batch input JSONL, exactly as CreateBatch would upload them.
+func (s *GptBatchSession) Export(w io.Writer) goerror.TraceableError {
+	if _, err := w.Write(s.createBatchData); err != nil {
+		return ErrSerializeBatchRequest.WithError(err).WithOrigin()
+	}
+	return nil
+}
+
+// Handles returns the handles of all requests added to the session, in their order.
+func (s *GptBatchSession) Handles() []*Handle {
+	return s.handles
+}
@@ -0,0 +1,185 @@
+package gpt
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/FrauElster/goerror"
+)
+
+// GptRequest is a single request, with the same arguments AddToBatch takes.
+type GptRequest struct {
+	CustomId     string
+	SystemPrompt string
+	UserPrompt   string
+	Options      []RequestOption
+}
+
+// submittedBatch is a batch created by submitBatches, with the custom_ids of its requests in order.
+type submittedBatch struct {
+	BatchId   string   `json:"batch_id"`
+	CustomIds []string `json:"custom_ids"`
+}
+
+// submitBatches adds the requests to as many batches as the file limits require and creates them.
+// On error, the batches created so far are returned as well, so they can be tracked or cancelled, see cancelBatches.
+func (g *Gpt) submitBatches(ctx context.Context, batchName string, requests []GptRequest, sessionOptions ...BatchSessionOption) ([]submittedBatch, goerror.TraceableError) {
+	return g.submit(ctx, batchName, len(requests), func(session *GptBatchSession, i int) (string, goerror.TraceableError) {
+		req := requests[i]
+		_, err := session.AddToBatch(req.CustomId, req.SystemPrompt, req.UserPrompt, req.Options...)
+		return req.CustomId, err
+	}, sessionOptions...)
+}
+
+// submitLines works like submitBatches for lines read back from batch input files, see resubmitFailed.
+func (g *Gpt) submitLines(ctx context.Context, batchName string, lines []gptBatchInputLine, sessionOptions ...BatchSessionOption) ([]submittedBatch, goerror.TraceableError) {
+	return g.submit(ctx, batchName, len(lines), func(session *GptBatchSession, i int) (string, goerror.TraceableError) {
+		line := lines[i]
+		session.endpoint = line.Url
+		req := gptBatchSingleRequest{CustomId: line.CustomId, Method: line.Method, Url: line.Url, Body: line.Body}
+		return line.CustomId, session.addLine(req, estimateBody(session.countTokens, line.Body))
+	}, sessionOptions...)
+}
+
+// submit adds n requests with add, creating a batch whenever the file limits are reached.
+func (g *Gpt) submit(ctx context.Context, batchName string, n int, add func(session *GptBatchSession, i int) (string, goerror.TraceableError), sessionOptions ...BatchSessionOption) ([]submittedBatch, goerror.TraceableError) {
+	batches := make([]submittedBatch, 0)
+	session, err := g.NewBatchSession(sessionOptions...)
+	if err != nil {
+		return batches, err
+	}
+	current := submittedBatch{}
+
+	flush := func() goerror.TraceableError {
+		if len(current.CustomIds) == 0 {
+			return nil
+		}
+		batchId, err := session.CreateBatch(ctx, batchName)
+		if err != nil {
+			return err
+		}
+		current.BatchId = batchId
+		batches = append(batches, current)
+		session, _ = g.NewBatchSession(sessionOptions...) // the options were validated above
+		current = submittedBatch{}
+		return nil
+	}
+
+	for i := range n {
+		customId, err := add(session, i)
+		if errors.Is(err, ErrExceedsFileLimit) {
+			if err := flush(); err != nil {
+				return batches, err
+			}
+			customId, err = add(session, i)
+		}
+		if err != nil {
+			return batches, err
+		}
+		current.CustomIds = append(current.CustomIds, customId)
+	}
+
+	if err := flush(); err != nil {
+		return batches, err
+	}
+	return batches, nil
+}
+
+// cancelBatches cancels batches that were created before a later submission failed,
+// so they are not paid for without anyone tracking their results.
+func (g *Gpt) cancelBatches(ctx context.Context, batches []submittedBatch) {
+	// the submission may have failed because ctx is done, the cancellation must still be sent
+	ctx = context.WithoutCancel(ctx)
+	for _, batch := range batches {
+		if err := cancelBatch(ctx, g.client, batch.BatchId); err != nil {
+			slog.Error("Failed to cancel batch of a failed submission", "error", err, "batchId", batch.BatchId)
+		}
+	}
+}
+
+// resubmitFailed submits the requests with the given custom_ids again, reading them from the input files of their batches.
+func (g *Gpt) resubmitFailed(ctx context.Context, batchName string, batches []submittedBatch, failed map[string]error) ([]submittedBatch, goerror.TraceableError) {
+	session, err := g.NewBatchSession()
+	if err != nil {
+		return nil, err
+	}
+	lines := make([]gptBatchInputLine, 0, len(failed))
+	picked := make(map[string]bool, len(failed))
+	for _, batch := range batches {
+		status, err := session.getBatch(ctx, batch.BatchId)
+		if err != nil {
+			return nil, err
+		}
+		input, err := session.getFile(ctx, status.InputFileID)
+		if err != nil {
+			return nil, err
+		}
+		batchLines, err := readBatchInputLines(bytes.NewReader(input))
+		if err != nil {
+			return nil, err
+		}
+		for _, line := range batchLines {
+			// a request resubmitted before is part of several input files
+			if _, ok := failed[line.CustomId]; ok && !picked[line.CustomId] {
+				picked[line.CustomId] = true
+				lines = append(lines, line)
+			}
+		}
+	}
+
+	resubmitted, err := g.submitLines(ctx, batchName, lines)
+	if err != nil {
+		g.cancelBatches(ctx, resubmitted)
+		return nil, err
+	}
+	return resubmitted, nil
+}
+
+// collectBatches retrieves the completions of all requests of the batches by custom_id.
+// If any batch is still running, ErrBatchNotCompleted is returned.
+// Requests without a valid result are reported in the error map, including those of failed, expired and cancelled batches,
+// whose completed requests are still collected.
+// A request that is part of several batches, because it was resubmitted, counts as answered if any of them answered it.
+func (g *Gpt) collectBatches(ctx context.Context, batches []submittedBatch) (map[string]GptCompletion, map[string]error, goerror.TraceableError) {
+	session, err := g.NewBatchSession()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	completions := make(map[string]GptCompletion)
+	errs := make(map[string]error)
+	for _, batch := range batches {
+		var batchErr goerror.TraceableError
+		batchCompletions, batchErrs, err := session.pollBatchedCompletions(ctx, batch.BatchId)
+		if errors.Is(err, ErrBatchFailed) {
+			// the batch will not change anymore, its requests without a result count as failed so they can be retried
+			batchErr = err
+			batchCompletions, batchErrs, err = session.retrievePartialCompletions(ctx, batch.BatchId)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, customId := range batch.CustomIds {
+			if completion, ok := batchCompletions[customId]; ok {
+				completions[customId] = completion
+				continue
+			}
+			if lineErr, ok := batchErrs[customId]; ok {
+				errs[customId] = lineErr
+				continue
+			}
+			if batchErr != nil {
+				errs[customId] = batchErr
+				continue
+			}
+			errs[customId] = fmt.Errorf("no result for custom_id %q in batch %s", customId, batch.BatchId)
+		}
+	}
+	for customId := range completions {
+		delete(errs, customId)
+	}
+	return completions, errs, nil
+}
@@ -0,0 +1,225 @@
+package tokenizer
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// The encodings split text into pieces with a regular expression before merging bytes.
+// Go's regexp has no lookahead, so the expressions are implemented by hand.
+// Each alternative is tried in order at the current position, like the regex engine would.
+//
+// cl100k_base:
+//
+//	(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+(?!\S)|\s+
+//
+// o200k_base:
+//
+//	[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]*[\p{Ll}\p{Lm}\p{Lo}\p{M}]+(?i:'s|'t|'re|'ve|'m|'ll|'d)?|
+//	[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]+[\p{Ll}\p{Lm}\p{Lo}\p{M}]*(?i:'s|'t|'re|'ve|'m|'ll|'d)?|
+//	\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n/]*|\s*[\r\n]+|\s+(?!\S)|\s+
+
+// runeText is text decoded into runes, keeping the byte offset of every rune.
+type runeText struct {
+	text    string
+	runes   []rune
+	offsets []int // offsets[i] is the byte offset of runes[i], offsets[len(runes)] is len(text)
+}
+
+func newRuneText(text string) runeText {
+	t := runeText{text: text, runes: make([]rune, 0, len(text)), offsets: make([]int, 0, len(text)+1)}
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		t.runes = append(t.runes, r)
+		t.offsets = append(t.offsets, i)
+		i += size
+	}
+	t.offsets = append(t.offsets, len(text))
+	return t
+}
+
+func (t runeText) at(i int) (rune, bool) {
+	if i < 0 || i >= len(t.runes) {
+		return 0, false
+	}
+	return t.runes[i], true
+}
+
+// is reports whether the rune at i satisfies f.
+func (t runeText) is(i int, f func(rune) bool) bool {
+	r, ok := t.at(i)
+	return ok && f(r)
+}
+
+// span returns the end of the run of runes satisfying f, starting at i.
+func (t runeText) span(i int, f func(rune) bool) int {
+	for t.is(i, f) {
+		i++
+	}
+	return i
+}
+
+func isNewline(r rune) bool { return r == '\r' || r == '\n' }
+func isLetter(r rune) bool  { return unicode.IsLetter(r) }
+func isNumber(r rune) bool  { return unicode.IsNumber(r) }
+func isSpace(r rune) bool   { return unicode.IsSpace(r) }
+
+// isPrefix matches [^\r\n\p{L}\p{N}]
+func isPrefix(r rune) bool { return !isNewline(r) && !isLetter(r) && !isNumber(r) }
+
+// isPunctuation matches [^\s\p{L}\p{N}]
+func isPunctuation(r rune) bool { return !isSpace(r) && !isLetter(r) && !isNumber(r) }
+
+// isUpper matches [\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]
+func isUpper(r rune) bool {
+	return unicode.In(r, unicode.Lu, unicode.Lt, unicode.Lm, unicode.Lo, unicode.M)
+}
+
+// isLower matches [\p{Ll}\p{Lm}\p{Lo}\p{M}]
+func isLower(r rune) bool {
+	return unicode.In(r, unicode.Ll, unicode.Lm, unicode.Lo, unicode.M)
+}
+
+// contraction matches (?i:'s|'t|'re|'ve|'m|'ll|'d) at i and returns its end, or i if there is none.
+func (t runeText) contraction(i int) int {
+	if !t.is(i, func(r rune) bool { return r == '\'' }) {
+		return i
+	}
+	lower := func(j int) rune {
+		r, _ := t.at(j)
+		return unicode.ToLower(r)
+	}
+	switch lower(i + 1) {
+	case 's', 't', 'm', 'd':
+		return i + 2
+	}
+	switch string([]rune{lower(i + 1), lower(i + 2)}) {
+	case "re", "ve", "ll":
+		return i + 3
+	}
+	return i
+}
+
+// numbers matches \p{N}{1,3}.
+func (t runeText) numbers(i int) int {
+	end := i
+	for end < i+3 && t.is(end, isNumber) {
+		end++
+	}
+	return end
+}
+
+// punctuation matches ` ?[^\s\p{L}\p{N}]+` followed by a run of trailing runes.
+func (t runeText) punctuation(i int, trailing func(rune) bool) int {
+	start := i
+	if t.is(start, func(r rune) bool { return r == ' ' }) && t.is(start+1, isPunctuation) {
+		start++
+	}
+	if !t.is(start, isPunctuation) {
+		return i
+	}
+	return t.span(t.span(start, isPunctuation), trailing)
+}
+
+// whitespace matches \s*[\r\n]+|\s+(?!\S)|\s+.
+func (t runeText) whitespace(i int) int {
+	end := t.span(i, isSpace)
+	if end == i {
+		return i
+	}
+
+	// \s*[\r\n]+ backtracks to the last newline of the run
+	for j := end - 1; j >= i; j-- {
+		if isNewline(t.runes[j]) {
+			return j + 1
+		}
+	}
+
+	// \s+(?!\S) leaves the last whitespace for the following word, unless the text ends
+	if end == len(t.runes) || end-i == 1 {
+		return end
+	}
+	return end - 1
+}
+
+func split(text string, next func(t runeText, i int) int) []string {
+	t := newRuneText(text)
+	pieces := make([]string, 0, len(t.runes)/3)
+	for i := 0; i < len(t.runes); {
+		end := next(t, i)
+		if end <= i {
+			// can not happen, \s+ or one of the other alternatives always matches, but never loop forever
+			end = i + 1
+		}
+		pieces = append(pieces, text[t.offsets[i]:t.offsets[end]])
+		i = end
+	}
+	return pieces
+}
+
+func splitCl100k(text string) []string {
+	return split(text, func(t runeText, i int) int {
+		if end := t.contraction(i); end > i {
+			return end
+		}
+
+		// [^\r\n\p{L}\p{N}]?\p{L}+
+		if t.is(i, isLetter) {
+			return t.span(i, isLetter)
+		}
+		if t.is(i, isPrefix) && t.is(i+1, isLetter) {
+			return t.span(i+1, isLetter)
+		}
+
+		if end := t.numbers(i); end > i {
+			return end
+		}
+		if end := t.punctuation(i, isNewline); end > i {
+			return end
+		}
+		return t.whitespace(i)
+	})
+}
+
+func splitO200k(text string) []string {
+	return split(text, func(t runeText, i int) int {
+		// [^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]*[\p{Ll}\p{Lm}\p{Lo}\p{M}]+ with contraction
+		lowerWord := func(start int) int {
+			upperEnd := t.span(start, isUpper)
+			// backtrack the greedy upper run until the lower run can match at least one rune
+			for j := upperEnd; j >= start; j-- {
+				if t.is(j, isLower) {
+					return t.contraction(t.span(j, isLower))
+				}
+			}
+			return start
+		}
+		// [^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]+[\p{Ll}\p{Lm}\p{Lo}\p{M}]* with contraction
+		upperWord := func(start int) int {
+			upperEnd := t.span(start, isUpper)
+			if upperEnd == start {
+				return start
+			}
+			return t.contraction(t.span(upperEnd, isLower))
+		}
+
+		for _, word := range []func(int) int{lowerWord, upperWord} {
+			if t.is(i, isPrefix) {
+				if end := word(i + 1); end > i+1 {
+					return end
+				}
+			}
+			if end := word(i); end > i {
+				return end
+			}
+		}
+
+		if end := t.numbers(i); end > i {
+			return end
+		}
+		if end := t.punctuation(i, func(r rune) bool { return isNewline(r) || r == '/' }); end > i {
+			return end
+		}
+		return t.whitespace(i)
+	})
+}
@@ -0,0 +1,286 @@
+// Package tokenizer implements the byte pair encodings o200k_base and cl100k_base used by OpenAI models.
+// The vocabularies are embedded, so counting tokens works offline.
+// They are taken from OpenAI's tiktoken and stored in its .tiktoken format, gzipped, see LICENSE-tiktoken for its license.
+package tokenizer
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"container/heap"
+	"embed"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/FrauElster/goerror"
+)
+
+var (
+	ErrUnknownEncoding = goerror.New("tokenizer:unknown_encoding", "Unknown encoding")
+	ErrLoadVocabulary  = goerror.New("tokenizer:load_vocabulary", "Failed to load vocabulary")
+)
+
+const (
+	O200kBase  = "o200k_base"
+	Cl100kBase = "cl100k_base"
+)
+
+//go:embed o200k_base.tiktoken.gz cl100k_base.tiktoken.gz
+var vocabularies embed.FS
+
+// Encoding is a byte pair encoding. It is safe for concurrent use.
+type Encoding struct {
+	name    string
+	ranks   map[string]int
+	decoder map[int]string
+	special map[string]int
+	split   func(text string) []string
+}
+
+type lazyEncoding struct {
+	once     sync.Once
+	encoding *Encoding
+	err      goerror.TraceableError
+}
+
+var encodings = map[string]*lazyEncoding{
+	O200kBase:  {},
+	Cl100kBase: {},
+}
+
+var specialTokens = map[string]map[string]int{
+	O200kBase: {
+		"<|endoftext|>":   199999,
+		"<|endofprompt|>": 200018,
+	},
+	Cl100kBase: {
+		"<|endoftext|>":   100257,
+		"<|fim_prefix|>":  100258,
+		"<|fim_middle|>":  100259,
+		"<|fim_suffix|>":  100260,
+		"<|endofprompt|>": 100276,
+	},
+}
+
+// Get returns the encoding with the given name, see O200kBase and Cl100kBase.
+// The vocabulary is loaded on first use.
+func Get(name string) (*Encoding, goerror.TraceableError) {
+	lazy, ok := encodings[name]
+	if !ok {
+		return nil, ErrUnknownEncoding.WithError(fmt.Errorf("encoding %q", name)).WithOrigin()
+	}
+
+	lazy.once.Do(func() {
+		lazy.encoding, lazy.err = load(name)
+	})
+	return lazy.encoding, lazy.err
+}
+
+// EncodingNameForModel returns the name of the encoding the model uses.
+// Unknown models are assumed to use o200k_base, like all current models do.
+func EncodingNameForModel(model string) string {
+	switch {
+	case strings.HasPrefix(model, "gpt-4o"), strings.HasPrefix(model, "chatgpt-4o"), strings.HasPrefix(model, "gpt-4.1"),
+		strings.HasPrefix(model, "gpt-4.5"), strings.HasPrefix(model, "gpt-5"), strings.HasPrefix(model, "o1"),
+		strings.HasPrefix(model, "o3"), strings.HasPrefix(model, "o4"):
+		return O200kBase
+	case strings.HasPrefix(model, "gpt-4"), strings.HasPrefix(model, "gpt-3.5"), strings.HasPrefix(model, "text-embedding-"):
+		return Cl100kBase
+	default:
+		return O200kBase
+	}
+}
+
+// ForModel returns the encoding the model uses.
+func ForModel(model string) (*Encoding, goerror.TraceableError) {
+	return Get(EncodingNameForModel(model))
+}
+
+// Count returns the number of tokens text has for the model.
+// It matches the signature of gpt.TokenCounter.
+func Count(model, text string) int {
+	e, err := ForModel(model)
+	if err != nil {
+		// the vocabularies are embedded, so this only happens on a broken build
+		return (len(text) + 3) / 4
+	}
+	return e.Count(text)
+}
+
+// Encode returns the tokens of text for the model.
+func Encode(model, text string) ([]int, goerror.TraceableError) {
+	e, err := ForModel(model)
+	if err != nil {
+		return nil, err
+	}
+	return e.Encode(text), nil
+}
+
+// Decode returns the text of the tokens for the model.
+func Decode(model string, tokens []int) (string, goerror.TraceableError) {
+	e, err := ForModel(model)
+	if err != nil {
+		return "", err
+	}
+	return e.Decode(tokens), nil
+}
+
+func load(name string) (*Encoding, goerror.TraceableError) {
+	compressed, err := vocabularies.ReadFile(name + ".tiktoken.gz")
+	if err != nil {
+		return nil, ErrLoadVocabulary.WithError(err).WithOrigin()
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, ErrLoadVocabulary.WithError(err).WithOrigin()
+	}
+	defer reader.Close()
+
+	e := &Encoding{
+		name:    name,
+		ranks:   make(map[string]int),
+		decoder: make(map[int]string),
+		special: specialTokens[name],
+		split:   splitO200k,
+	}
+	if name == Cl100kBase {
+		e.split = splitCl100k
+	}
+
+	// every line is the base64 encoded token followed by its rank
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		token, rank, ok := strings.Cut(scanner.Text(), " ")
+		if !ok {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(token)
+		if err != nil {
+			return nil, ErrLoadVocabulary.WithError(fmt.Errorf("invalid token %q: %w", token, err)).WithOrigin()
+		}
+		r, err := strconv.Atoi(rank)
+		if err != nil {
+			return nil, ErrLoadVocabulary.WithError(fmt.Errorf("invalid rank %q: %w", rank, err)).WithOrigin()
+		}
+		e.ranks[string(decoded)] = r
+		e.decoder[r] = string(decoded)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, ErrLoadVocabulary.WithError(err).WithOrigin()
+	}
+	for token, rank := range e.special {
+		e.decoder[rank] = token
+	}
+
+	return e, nil
+}
+
+// Name returns the name of the encoding.
+func (e *Encoding) Name() string { return e.name }
+
+// Encode returns the tokens of text.
+// Special tokens like <|endoftext|> are encoded as ordinary text, as the API does for user content.
+func (e *Encoding) Encode(text string) []int {
+	tokens := make([]int, 0, len(text)/3)
+	for _, piece := range e.split(text) {
+		if rank, ok := e.ranks[piece]; ok {
+			tokens = append(tokens, rank)
+			continue
+		}
+		tokens = e.bytePairEncode(piece, tokens)
+	}
+	return tokens
+}
+
+// Count returns the number of tokens of text.
+func (e *Encoding) Count(text string) int {
+	return len(e.Encode(text))
+}
+
+// Decode returns the text of the tokens. Unknown tokens are skipped.
+// A slice of tokens may end within a multi-byte character, which is then not valid UTF-8.
+func (e *Encoding) Decode(tokens []int) string {
+	var b strings.Builder
+	for _, token := range tokens {
+		b.WriteString(e.decoder[token])
+	}
+	return b.String()
+}
+
+// bytePairEncode merges the bytes of piece by rank, starting with the lowest, until no known pair is left.
+// The tokens are appended to dst.
+// The parts form a linked list by their start offset, and the mergeable pairs are kept in a heap by rank,
+// so each merge only ranks the pairs of its neighbours again instead of scanning the whole piece.
+func (e *Encoding) bytePairEncode(piece string, dst []int) []int {
+	n := len(piece)
+	// next[i] and prev[i] are the starts of the parts around the part starting at i, n marks the end
+	next := make([]int, n)
+	prev := make([]int, n)
+	for i := range n {
+		next[i], prev[i] = i+1, i-1
+	}
+
+	pairs := make(mergeHeap, 0, n)
+	push := func(start int) {
+		if start < 0 || next[start] >= n {
+			return
+		}
+		end := next[next[start]]
+		if rank, ok := e.ranks[piece[start:end]]; ok {
+			heap.Push(&pairs, mergePair{rank: rank, start: start, end: end})
+		}
+	}
+	for i := range n {
+		push(i)
+	}
+
+	for pairs.Len() > 0 {
+		pair := heap.Pop(&pairs).(mergePair)
+		// pairs are not removed when one of their parts merges, skip the outdated ones
+		if next[pair.start] >= n || next[next[pair.start]] != pair.end {
+			continue
+		}
+		right := next[pair.start]
+		after := next[right]
+		next[pair.start] = after
+		if after < n {
+			prev[after] = pair.start
+		}
+		// the right part is gone, its own pairs are outdated now
+		next[right] = n
+		push(prev[pair.start])
+		push(pair.start)
+	}
+
+	for i := 0; i < n; i = next[i] {
+		dst = append(dst, e.ranks[piece[i:next[i]]])
+	}
+	return dst
+}
+
+// mergePair is a pair of adjacent parts spanning piece[start:end].
+type mergePair struct {
+	rank, start, end int
+}
+
+// mergeHeap orders pairs by rank, and equal ranks by position, as tiktoken merges the leftmost first.
+type mergeHeap []mergePair
+
+func (h mergeHeap) Len() int { return len(h) }
+func (h mergeHeap) Less(i, j int) bool {
+	if h[i].rank != h[j].rank {
+		return h[i].rank < h[j].rank
+	}
+	return h[i].start < h[j].start
+}
+func (h mergeHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *mergeHeap) Push(x any)   { *h = append(*h, x.(mergePair)) }
+func (h *mergeHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
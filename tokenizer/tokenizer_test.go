@@ -0,0 +1,148 @@
+package tokenizer
+
+import (
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+// reference ids as produced by OpenAI's tiktoken
+var referenceVectors = []struct {
+	encoding string
+	text     string
+	tokens   []int
+}{
+	{Cl100kBase, "", []int{}},
+	{Cl100kBase, "hello world", []int{15339, 1917}},
+	{Cl100kBase, "Hello, world!", []int{9906, 11, 1917, 0}},
+	{Cl100kBase, "rer", []int{38149}},
+	{Cl100kBase, "'rer", []int{2351, 81}},
+	{Cl100kBase, "today\n ", []int{31213, 198, 220}},
+	{Cl100kBase, "today\n \n", []int{31213, 27907}},
+	{Cl100kBase, "today\n  \n", []int{31213, 14211}},
+	{Cl100kBase, "👍", []int{9468, 239, 235}},
+	{O200kBase, "", []int{}},
+	{O200kBase, "hello world", []int{24912, 2375}},
+	{O200kBase, "Hello, world!", []int{13225, 11, 2375, 0}},
+}
+
+// edge cases of the o200k_base pre-tokenizer, the pieces are split by hand along its regular expression
+// and merged with the ranks of the vocabulary, they are not generated by tiktoken itself
+var o200kSplitVectors = []struct {
+	text   string
+	tokens []int
+}{
+	{"HTTPServer", []int{17893, 6444}},                 // "HTTPServer" is one piece: "HTTP" "Server"
+	{"HTTPServer's", []int{17893, 6444, 885}},          // the contraction joins the piece: "HTTP" "Server" "'s"
+	{"WE'RE", []int{18092, 6, 1099}},                   // contractions are case insensitive: "WE" "'" "RE"
+	{"They'll", []int{12280, 6090}},                    // "They" "'ll"
+	{"don't", []int{91418}},                            // "don't"
+	{"café", []int{66, 103112}},                        // "c" "afé"
+	{"naïve", []int{1503, 9954, 737}},                  // "na" "ï" "ve"
+	{"Ελληνικά", []int{10303, 75237, 33428}},           // "Ε" "λλην" "ικά"
+	{"1234567", []int{7633, 19354, 22}},                // digits in groups of three: "123" "456" "7"
+	{"3.14159", []int{18, 13, 16926, 4621}},            // "3" "." "141" "59"
+	{"path/to/file\n", []int{4189, 72231, 51766, 198}}, // a slash starts a word: "path" "/to" "/file" "\n"
+	{"  indented", []int{220, 1383, 23537}},            // the last space joins the word: " " " ind" "ented"
+	{"hello\n\nworld", []int{24912, 279, 24169}},       // "hello" "\n\n" "world"
+}
+
+func TestEncodeReferenceVectors(t *testing.T) {
+	for _, v := range referenceVectors {
+		e, err := Get(v.encoding)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tokens := e.Encode(v.text); !slices.Equal(tokens, v.tokens) {
+			t.Errorf("%s: Encode(%q) = %v, want %v", v.encoding, v.text, tokens, v.tokens)
+		}
+		if text := e.Decode(v.tokens); text != v.text {
+			t.Errorf("%s: Decode(%v) = %q, want %q", v.encoding, v.tokens, text, v.text)
+		}
+	}
+}
+
+func TestEncodeO200kSplitVectors(t *testing.T) {
+	e, err := Get(O200kBase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range o200kSplitVectors {
+		if tokens := e.Encode(v.text); !slices.Equal(tokens, v.tokens) {
+			t.Errorf("Encode(%q) = %v, want %v", v.text, tokens, v.tokens)
+		}
+	}
+}
+
+func TestSpecialTokensAreEncodedAsText(t *testing.T) {
+	e, err := Get(Cl100kBase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens := e.Encode("<|endoftext|>")
+	if slices.Contains(tokens, 100257) {
+		t.Errorf("Encode returned the special token: %v", tokens)
+	}
+	if text := e.Decode(tokens); text != "<|endoftext|>" {
+		t.Errorf("Decode = %q", text)
+	}
+}
+
+// TestBytePairEncodeMatchesNaiveMerge compares the merge loop to merging the lowest ranked pair by scanning the whole piece.
+func TestBytePairEncodeMatchesNaiveMerge(t *testing.T) {
+	alphabet := []string{"a", "b", "e", "r", "t", " ", "\n", "ö", "的", "👍", "0", "ing", "the"}
+	rng := rand.New(rand.NewPCG(1, 2))
+	for _, name := range []string{Cl100kBase, O200kBase} {
+		e, err := Get(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for range 2000 {
+			var piece string
+			for range rng.IntN(40) + 1 {
+				piece += alphabet[rng.IntN(len(alphabet))]
+			}
+			got := e.bytePairEncode(piece, nil)
+			want := naiveBytePairEncode(e, piece)
+			if !slices.Equal(got, want) {
+				t.Fatalf("%s: bytePairEncode(%q) = %v, want %v", name, piece, got, want)
+			}
+		}
+	}
+}
+
+func naiveBytePairEncode(e *Encoding, piece string) []int {
+	boundaries := make([]int, len(piece)+1)
+	for i := range boundaries {
+		boundaries[i] = i
+	}
+	for len(boundaries) > 2 {
+		minRank, minIdx := 0, -1
+		for i := 0; i < len(boundaries)-2; i++ {
+			if rank, ok := e.ranks[piece[boundaries[i]:boundaries[i+2]]]; ok && (minIdx == -1 || rank < minRank) {
+				minRank, minIdx = rank, i
+			}
+		}
+		if minIdx == -1 {
+			break
+		}
+		boundaries = append(boundaries[:minIdx+1], boundaries[minIdx+2:]...)
+	}
+	tokens := make([]int, 0, len(boundaries)-1)
+	for i := 0; i < len(boundaries)-1; i++ {
+		tokens = append(tokens, e.ranks[piece[boundaries[i]:boundaries[i+1]]])
+	}
+	return tokens
+}
+
+func BenchmarkEncodeRepetitive(b *testing.B) {
+	e, err := Get(O200kBase)
+	if err != nil {
+		b.Fatal(err)
+	}
+	text := string(slices.Repeat([]byte("x"), 10000))
+	b.ResetTimer()
+	for range b.N {
+		e.Encode(text)
+	}
+}
@@ -0,0 +1,237 @@
+package gpt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/FrauElster/goerror"
+)
+
+var (
+	ErrToolDefinition = goerror.New("gpt:tool_definition", "Invalid tool definition")
+	ErrToolCall       = goerror.New("gpt:tool_call", "Failed to call tool")
+	ErrToolLoop       = goerror.New("gpt:tool_loop", "Model did not produce a final answer")
+)
+
+// Tool is a function the model may call.
+// A Tool created with NewTool is only declared to the model, a Tool created with NewFuncTool can also be invoked by the agent loop.
+type Tool struct {
+	Name        string
+	Description string
+
+	params reflect.Type
+	schema map[string]any
+	call   func(ctx context.Context, arguments string) (string, error)
+}
+
+// NewTool declares a tool whose arguments are described by params.
+// params must be a struct or pointer to a struct, its JSON schema is used as the tool parameters.
+func NewTool(name, description string, params any) (Tool, goerror.TraceableError) {
+	schema, err := getJsonSchema(params)
+	if err != nil {
+		return Tool{}, ErrToolDefinition.WithError(err).WithOrigin()
+	}
+
+	t := reflect.TypeOf(params)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	return Tool{Name: name, Description: description, params: t, schema: schema}, nil
+}
+
+// NewFuncTool declares a tool backed by a Go function.
+// The arguments the model generates are decoded into In, the result of fn is encoded as JSON and fed back to the model.
+// If Out is a string, it is passed to the model as is.
+// In may be a struct or a pointer to a struct, a pointer is always allocated.
+func NewFuncTool[In, Out any](name, description string, fn func(context.Context, In) (Out, error)) (Tool, goerror.TraceableError) {
+	inType := reflect.TypeFor[In]()
+	isPtr := inType.Kind() == reflect.Ptr
+	if isPtr {
+		inType = inType.Elem()
+	}
+	tool, err := NewTool(name, description, reflect.New(inType).Interface())
+	if err != nil {
+		return Tool{}, err
+	}
+
+	tool.call = func(ctx context.Context, arguments string) (string, error) {
+		var in In
+		target := any(&in)
+		if isPtr {
+			// decode into a fresh value, so fn never gets a nil pointer
+			in = reflect.New(inType).Interface().(In)
+			target = in
+		}
+		if err := json.Unmarshal([]byte(arguments), target); err != nil {
+			return "", fmt.Errorf("failed to decode arguments: %w", err)
+		}
+		out, err := fn(ctx, in)
+		if err != nil {
+			return "", err
+		}
+		if s, ok := any(out).(string); ok {
+			return s, nil
+		}
+		serialized, err := json.Marshal(out)
+		if err != nil {
+			return "", fmt.Errorf("failed to encode result: %w", err)
+		}
+		return string(serialized), nil
+	}
+
+	return tool, nil
+}
+
+func (t Tool) definition() gptTool {
+	return gptTool{
+		Type: "function",
+		Function: gptFunctionDefinition{
+			Name:        t.Name,
+			Description: t.Description,
+			Parameters:  t.schema,
+			Strict:      true,
+		},
+	}
+}
+
+// ToolRegistry holds the tools available to the model, looked up by name.
+type ToolRegistry struct {
+	tools []Tool
+	index map[string]int
+}
+
+// NewToolRegistry creates a registry with the given tools.
+func NewToolRegistry(tools ...Tool) (*ToolRegistry, goerror.TraceableError) {
+	r := &ToolRegistry{index: make(map[string]int)}
+	if err := r.Register(tools...); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Register adds tools to the registry. Tool names must be unique.
+func (r *ToolRegistry) Register(tools ...Tool) goerror.TraceableError {
+	for _, tool := range tools {
+		if tool.Name == "" {
+			return ErrToolDefinition.WithError(fmt.Errorf("tool name must not be empty")).WithOrigin()
+		}
+		if _, ok := r.index[tool.Name]; ok {
+			return ErrToolDefinition.WithError(fmt.Errorf("tool %q already registered", tool.Name)).WithOrigin()
+		}
+		r.index[tool.Name] = len(r.tools)
+		r.tools = append(r.tools, tool)
+	}
+	return nil
+}
+
+// Get returns the tool with the given name.
+func (r *ToolRegistry) Get(name string) (Tool, bool) {
+	idx, ok := r.index[name]
+	if !ok {
+		return Tool{}, false
+	}
+	return r.tools[idx], true
+}
+
+// Tools returns all registered tools in registration order.
+func (r *ToolRegistry) Tools() []Tool {
+	return append([]Tool(nil), r.tools...)
+}
+
+// Call invokes the Go function registered for the tool call and returns its result.
+func (r *ToolRegistry) Call(ctx context.Context, call GptToolCall) (string, goerror.TraceableError) {
+	tool, ok := r.Get(call.Function.Name)
+	if !ok {
+		return "", ErrToolCall.WithError(fmt.Errorf("unknown tool %q", call.Function.Name)).WithOrigin()
+	}
+	if tool.call == nil {
+		return "", ErrToolCall.WithError(fmt.Errorf("tool %q has no function attached", call.Function.Name)).WithOrigin()
+	}
+
+	result, err := tool.call(ctx, call.Function.Arguments)
+	if err != nil {
+		return "", ErrToolCall.WithError(fmt.Errorf("tool %q: %w", call.Function.Name, err)).WithOrigin()
+	}
+	return result, nil
+}
+
+func (r *ToolRegistry) definitions() []gptTool {
+	return MapSlice(r.tools, Tool.definition)
+}
+
+// WithTools declares the tools of the registry to the model.
+var WithTools = func(registry *ToolRegistry) RequestOption {
+	return func(a *appliedRequestOption) error {
+		if registry == nil {
+			return fmt.Errorf("tool registry must not be nil")
+		}
+		a.tools = registry
+		return nil
+	}
+}
+
+// WithAgentLoop lets synchronous requests invoke the registered tools and feed their results back to the model,
+// until it answers without tool calls. maxRounds limits the number of tool rounds, after that ErrToolLoop is returned.
+// It has no effect on batched requests, since they can not be continued.
+var WithAgentLoop = func(maxRounds int) RequestOption {
+	return func(a *appliedRequestOption) error {
+		if maxRounds <= 0 {
+			return fmt.Errorf("maxRounds must be positive, got %d", maxRounds)
+		}
+		a.maxToolRounds = maxRounds
+		return nil
+	}
+}
+
+// WithToolChoice forces the model to call the tool with the given name.
+// The tool must be declared with WithTools. Combined with a batch, this is an alternative to WithJsonSchema:
+// the answer is in the arguments of the tool call, see RetrieveBatchedCompletion and DecodeToolArguments.
+var WithToolChoice = func(name string) RequestOption {
+	return func(a *appliedRequestOption) error {
+		if a.tools == nil {
+			return fmt.Errorf("tool choice %q requires WithTools to be applied first", name)
+		}
+		if _, ok := a.tools.Get(name); !ok {
+			return fmt.Errorf("unknown tool %q", name)
+		}
+		a.toolChoice = name
+		return nil
+	}
+}
+
+// ToolCall returns the first call of the tool with the given name.
+func (c GptCompletion) ToolCall(name string) (GptToolCall, bool) {
+	for _, call := range c.ToolCalls {
+		if call.Function.Name == name {
+			return call, true
+		}
+	}
+	return GptToolCall{}, false
+}
+
+// DecodeArguments decodes the arguments of the call into a new value of the struct the tool was declared from.
+// The result is a pointer to that struct.
+func (t Tool) DecodeArguments(call GptToolCall) (any, goerror.TraceableError) {
+	if call.Function.Name != t.Name {
+		return nil, ErrToolCall.WithError(fmt.Errorf("call is for tool %q, not %q", call.Function.Name, t.Name)).WithOrigin()
+	}
+
+	v := reflect.New(t.params).Interface()
+	if err := json.Unmarshal([]byte(call.Function.Arguments), v); err != nil {
+		return nil, ErrToolCall.WithError(fmt.Errorf("failed to decode arguments: %w", err)).WithOrigin()
+	}
+	return v, nil
+}
+
+// DecodeToolArguments decodes the arguments of the call into T.
+// T should be the struct the tool was declared from.
+func DecodeToolArguments[T any](call GptToolCall) (T, goerror.TraceableError) {
+	var v T
+	if err := json.Unmarshal([]byte(call.Function.Arguments), &v); err != nil {
+		return v, ErrToolCall.WithError(fmt.Errorf("failed to decode arguments of %q: %w", call.Function.Name, err)).WithOrigin()
+	}
+	return v, nil
+}
@@ -0,0 +1,205 @@
+package gpt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/FrauElster/goerror"
+)
+
+// batchDiscount is the factor the Batch API charges compared to synchronous requests.
+const batchDiscount = 0.5
+
+// ModelPrice is the price of a model in USD per one million tokens.
+type ModelPrice struct {
+	Input       float64
+	CachedInput float64
+	Output      float64
+}
+
+// PriceTable maps model names to their prices.
+// Dated snapshots like "gpt-4o-mini-2024-07-18" are priced like the model they are a snapshot of,
+// other variants like "o3-pro" need their own entry.
+type PriceTable map[string]ModelPrice
+
+// DefaultPriceTable holds the synchronous list prices at the time of writing.
+// Prices change, pass your own table with WithPriceTable if you rely on exact numbers.
+var DefaultPriceTable = PriceTable{
+	"gpt-4o":                 {Input: 2.50, CachedInput: 1.25, Output: 10.00},
+	"gpt-4o-mini":            {Input: 0.15, CachedInput: 0.075, Output: 0.60},
+	"gpt-4.1":                {Input: 2.00, CachedInput: 0.50, Output: 8.00},
+	"gpt-4.1-mini":           {Input: 0.40, CachedInput: 0.10, Output: 1.60},
+	"gpt-4.1-nano":           {Input: 0.10, CachedInput: 0.025, Output: 0.40},
+	"o1":                     {Input: 15.00, CachedInput: 7.50, Output: 60.00},
+	"o1-mini":                {Input: 1.10, CachedInput: 0.55, Output: 4.40},
+	"o3":                     {Input: 2.00, CachedInput: 0.50, Output: 8.00},
+	"o3-mini":                {Input: 1.10, CachedInput: 0.55, Output: 4.40},
+	"o4-mini":                {Input: 1.10, CachedInput: 0.275, Output: 4.40},
+	"text-embedding-3-small": {Input: 0.02},
+	"text-embedding-3-large": {Input: 0.13},
+	"text-embedding-ada-002": {Input: 0.10},
+}
+
+// snapshotSuffix matches the date OpenAI appends to model snapshots.
+var snapshotSuffix = regexp.MustCompile(`-\d{4}-\d{2}-\d{2}$`)
+
+// Lookup returns the price of the model, or of the model a dated snapshot belongs to.
+func (t PriceTable) Lookup(model string) (ModelPrice, bool) {
+	if price, ok := t[model]; ok {
+		return price, true
+	}
+	if base := snapshotSuffix.ReplaceAllString(model, ""); base != model {
+		price, ok := t[base]
+		return price, ok
+	}
+	return ModelPrice{}, false
+}
+
+// Cost returns the cost of the usage in USD. If batch is set, the Batch API discount is applied.
+func (p ModelPrice) Cost(usage GptUsage, batch bool) float64 {
+	uncached := usage.PromptTokens - usage.CachedTokens
+	cost := (float64(uncached)*p.Input + float64(usage.CachedTokens)*p.CachedInput + float64(usage.CompletionTokens)*p.Output) / 1_000_000
+	if batch {
+		cost *= batchDiscount
+	}
+	return cost
+}
+
+func (u GptUsage) add(other GptUsage) GptUsage {
+	return GptUsage{
+		PromptTokens:     u.PromptTokens + other.PromptTokens,
+		CachedTokens:     u.CachedTokens + other.CachedTokens,
+		CompletionTokens: u.CompletionTokens + other.CompletionTokens,
+		ReasoningTokens:  u.ReasoningTokens + other.ReasoningTokens,
+	}
+}
+
+// GptUsageReport is the token usage of a batch, aggregated per model.
+type GptUsageReport struct {
+	BatchId  string
+	Requests int
+	Failed   int
+	Models   map[string]GptUsage
+}
+
+// Total returns the usage over all models.
+func (r GptUsageReport) Total() GptUsage {
+	var total GptUsage
+	for _, usage := range r.Models {
+		total = total.add(usage)
+	}
+	return total
+}
+
+// GptCostReport is the cost of a batch in USD, per model and in total.
+// Models not found in the price table are listed in Unpriced and not part of the total.
+type GptCostReport struct {
+	BatchId  string
+	Models   map[string]float64
+	Total    float64
+	Unpriced []string
+}
+
+// Cost prices the report at batch prices.
+func (r GptUsageReport) Cost(prices PriceTable) GptCostReport {
+	report := GptCostReport{BatchId: r.BatchId, Models: make(map[string]float64, len(r.Models))}
+	for model, usage := range r.Models {
+		price, ok := prices.Lookup(model)
+		if !ok {
+			report.Unpriced = append(report.Unpriced, model)
+			continue
+		}
+		cost := price.Cost(usage, true)
+		report.Models[model] = cost
+		report.Total += cost
+	}
+	sort.Strings(report.Unpriced)
+	return report
+}
+
+// Usage aggregates the token usage of all requests of a completed batch per model.
+// If the batch is not completed yet, ErrBatchNotCompleted is returned.
+func (s *GptBatchSession) Usage(ctx context.Context, batchId string) (GptUsageReport, goerror.TraceableError) {
+	file, err := s.getOutputFile(ctx, batchId)
+	if err != nil {
+		return GptUsageReport{}, err
+	}
+
+	report := GptUsageReport{BatchId: batchId, Models: make(map[string]GptUsage)}
+	for _, line := range bytes.Split(file, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		report.Requests++
+
+		model, usage, err := parseUsageLine(line)
+		if err != nil {
+			report.Failed++
+			continue
+		}
+		report.Models[model] = report.Models[model].add(usage)
+	}
+	return report, nil
+}
+
+// Cost returns the cost of a completed batch, priced with the table set by WithPriceTable.
+func (s *GptBatchSession) Cost(ctx context.Context, batchId string) (GptCostReport, goerror.TraceableError) {
+	report, err := s.Usage(ctx, batchId)
+	if err != nil {
+		return GptCostReport{}, err
+	}
+	return report.Cost(s.prices), nil
+}
+
+// parseUsageLine extracts the usage of a batch output line, regardless of the endpoint it was sent to.
+func parseUsageLine(line []byte) (string, GptUsage, error) {
+	var response gptBatchSingleResponse
+	if err := json.Unmarshal(line, &response); err != nil {
+		return "", GptUsage{}, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if err := response.err(); err != nil {
+		return "", GptUsage{}, err
+	}
+	return parseUsageBody(response.Response.Body)
+}
+
+// parseUsageBody extracts the model and usage of a response body.
+func parseUsageBody(responseBody json.RawMessage) (string, GptUsage, error) {
+	// chat completions and embeddings use prompt/completion tokens, the Responses API input/output tokens
+	var body struct {
+		Model string `json:"model"`
+		Usage struct {
+			PromptTokens        int `json:"prompt_tokens"`
+			PromptTokensDetails struct {
+				CachedTokens int `json:"cached_tokens"`
+			} `json:"prompt_tokens_details"`
+			CompletionTokens        int `json:"completion_tokens"`
+			CompletionTokensDetails struct {
+				ReasoningTokens int `json:"reasoning_tokens"`
+			} `json:"completion_tokens_details"`
+			InputTokens        int `json:"input_tokens"`
+			InputTokensDetails struct {
+				CachedTokens int `json:"cached_tokens"`
+			} `json:"input_tokens_details"`
+			OutputTokens        int `json:"output_tokens"`
+			OutputTokensDetails struct {
+				ReasoningTokens int `json:"reasoning_tokens"`
+			} `json:"output_tokens_details"`
+		} `json:"usage"`
+	}
+	if err := json.Unmarshal(responseBody, &body); err != nil {
+		return "", GptUsage{}, fmt.Errorf("failed to decode response body: %w", err)
+	}
+
+	u := body.Usage
+	return body.Model, GptUsage{
+		PromptTokens:     u.PromptTokens + u.InputTokens,
+		CachedTokens:     u.PromptTokensDetails.CachedTokens + u.InputTokensDetails.CachedTokens,
+		CompletionTokens: u.CompletionTokens + u.OutputTokens,
+		ReasoningTokens:  u.CompletionTokensDetails.ReasoningTokens + u.OutputTokensDetails.ReasoningTokens,
+	}, nil
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"os"
 	"strings"
 )
 
@@ -91,3 +92,30 @@ func SliceContains[I comparable](slice []I, value I) bool {
 	}
 	return false
 }
+
+// writeJsonFile writes v as JSON to filepath.
+// It writes to a temporary file first, so a crash does not leave a corrupt file behind.
+func writeJsonFile(filepath string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize %s: %w", filepath, err)
+	}
+	tmp := filepath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath)
+}
+
+// readJsonFile reads the JSON in filepath into v.
+// If the file does not exist, an error wrapping os.ErrNotExist is returned.
+func readJsonFile(filepath string, v any) error {
+	data, err := os.ReadFile(filepath)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", filepath, err)
+	}
+	return nil
+}
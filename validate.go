@@ -0,0 +1,329 @@
+package gpt
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// limits of a single batch input file, variables so tests can lower them
+var (
+	maxBatchRequests = 50000
+	maxBatchFileSize = 512 * 1024 * 1024
+)
+
+// limits of strict structured outputs
+const (
+	maxSchemaDepth      = 10
+	maxSchemaProperties = 5000
+)
+
+var schemaNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// LineError is a problem of a single line of a batch input file.
+type LineError struct {
+	// Line is the 1-based line number, 0 if the error concerns the whole file.
+	Line int
+	// CustomId is the custom_id of the line, if it could be read.
+	CustomId string
+	Err      error
+}
+
+func (e LineError) Error() string {
+	if e.Line == 0 {
+		return e.Err.Error()
+	}
+	if e.CustomId == "" {
+		return fmt.Sprintf("line %d: %s", e.Line, e.Err)
+	}
+	return fmt.Sprintf("line %d (%s): %s", e.Line, e.CustomId, e.Err)
+}
+
+func (e LineError) Unwrap() error { return e.Err }
+
+// ValidateBatchInput checks a batch input JSONL before it is uploaded, and returns every problem found, nil if there is none.
+// It checks the JSON syntax and the required fields of every line, that custom_ids are unique,
+// that all lines target the same endpoint and model, the file limits,
+// and the rules of strict structured outputs for lines with a json_schema response format.
+func ValidateBatchInput(r io.Reader) []LineError {
+	rawLines, err := readRawLines(r)
+	if err != nil {
+		return []LineError{{Err: err}}
+	}
+
+	var errs []LineError
+	size, requests := 0, 0
+	seen := make(map[string]int)
+	var endpoint GptEndpoint
+	var model string
+	endpointLine, modelLine := 0, 0
+	for i, raw := range rawLines {
+		size += len(raw) + 1
+		if len(strings.TrimSpace(string(raw))) == 0 {
+			continue
+		}
+		requests++
+		lineNo := i + 1
+		fail := func(customId string, err error) {
+			errs = append(errs, LineError{Line: lineNo, CustomId: customId, Err: err})
+		}
+
+		var line gptBatchInputLine
+		if err := json.Unmarshal(raw, &line); err != nil {
+			fail("", err)
+			continue
+		}
+		if err := validateInputLine(line); err != nil {
+			fail(line.CustomId, err)
+			continue
+		}
+		if first, ok := seen[line.CustomId]; ok {
+			fail(line.CustomId, fmt.Errorf("custom_id is already used in line %d", first))
+		} else {
+			seen[line.CustomId] = lineNo
+		}
+
+		if endpoint == "" {
+			endpoint, endpointLine = line.Url, lineNo
+		} else if line.Url != endpoint {
+			fail(line.CustomId, fmt.Errorf("url %s differs from %s in line %d", line.Url, endpoint, endpointLine))
+		}
+
+		lineModel, bodyErrs := validateInputBody(line)
+		for _, err := range bodyErrs {
+			fail(line.CustomId, err)
+		}
+		if lineModel == "" {
+			continue
+		}
+		if model == "" {
+			model, modelLine = lineModel, lineNo
+		} else if lineModel != model {
+			fail(line.CustomId, fmt.Errorf("model %s differs from %s in line %d", lineModel, model, modelLine))
+		}
+	}
+
+	if requests > maxBatchRequests {
+		errs = append(errs, LineError{Err: fmt.Errorf("%d requests exceed the limit of %d", requests, maxBatchRequests)})
+	}
+	if size > maxBatchFileSize {
+		errs = append(errs, LineError{Err: fmt.Errorf("%d bytes exceed the limit of %d", size, maxBatchFileSize)})
+	}
+	return errs
+}
+
+// validateInputBody checks the required fields of the body for its endpoint, and the json_schema if there is one.
+// It returns the model of the request.
+func validateInputBody(line gptBatchInputLine) (string, []error) {
+	var body struct {
+		Model          string          `json:"model"`
+		Messages       json.RawMessage `json:"messages"`
+		Input          json.RawMessage `json:"input"`
+		ResponseFormat *struct {
+			Type       string `json:"type"`
+			JsonSchema *struct {
+				Name   string         `json:"name"`
+				Strict bool           `json:"strict"`
+				Schema map[string]any `json:"schema"`
+			} `json:"json_schema"`
+		} `json:"response_format"`
+		Text *struct {
+			Format *struct {
+				Type   string         `json:"type"`
+				Name   string         `json:"name"`
+				Strict bool           `json:"strict"`
+				Schema map[string]any `json:"schema"`
+			} `json:"format"`
+		} `json:"text"`
+	}
+	if err := json.Unmarshal(line.Body, &body); err != nil {
+		return "", []error{fmt.Errorf("invalid body: %w", err)}
+	}
+
+	var errs []error
+	if body.Model == "" {
+		errs = append(errs, errors.New("body.model is missing"))
+	}
+	switch line.Url {
+	case EndpointChatCompletions:
+		if isEmptyJson(body.Messages) {
+			errs = append(errs, errors.New("body.messages is missing"))
+		}
+	case EndpointEmbeddings, EndpointResponses:
+		if isEmptyJson(body.Input) {
+			errs = append(errs, errors.New("body.input is missing"))
+		}
+	}
+
+	var name string
+	var strict bool
+	var schema map[string]any
+	switch {
+	case body.ResponseFormat != nil && body.ResponseFormat.Type == "json_schema":
+		if body.ResponseFormat.JsonSchema == nil {
+			return body.Model, append(errs, errors.New("body.response_format.json_schema is missing"))
+		}
+		name, strict, schema = body.ResponseFormat.JsonSchema.Name, body.ResponseFormat.JsonSchema.Strict, body.ResponseFormat.JsonSchema.Schema
+	case body.Text != nil && body.Text.Format != nil && body.Text.Format.Type == "json_schema":
+		name, strict, schema = body.Text.Format.Name, body.Text.Format.Strict, body.Text.Format.Schema
+	default:
+		return body.Model, errs
+	}
+
+	if !schemaNamePattern.MatchString(name) {
+		errs = append(errs, fmt.Errorf("schema name %q must match %s", name, schemaNamePattern))
+	}
+	if schema == nil {
+		return body.Model, append(errs, errors.New("schema is missing"))
+	}
+	if strict {
+		errs = append(errs, validateStrictSchema(schema)...)
+	}
+	return body.Model, errs
+}
+
+func isEmptyJson(raw json.RawMessage) bool {
+	s := strings.TrimSpace(string(raw))
+	return s == "" || s == "null" || s == "[]" || s == `""`
+}
+
+// validateStrictSchema checks the rules of strict structured outputs:
+// the root is an object, every object lists all its properties as required and disallows additional properties,
+// and the nesting and the number of properties stay within the limits.
+func validateStrictSchema(schema map[string]any) []error {
+	v := strictSchemaValidator{schema: schema}
+	root := v.resolve(schema)
+	if t, _ := root["type"].(string); t != "object" {
+		v.errs = append(v.errs, errors.New("schema: the root must be an object"))
+	}
+	v.walk(root, "schema", 1, map[string]bool{})
+	if v.properties > maxSchemaProperties {
+		v.errs = append(v.errs, fmt.Errorf("schema: %d properties exceed the limit of %d", v.properties, maxSchemaProperties))
+	}
+	return v.errs
+}
+
+type strictSchemaValidator struct {
+	schema     map[string]any
+	properties int
+	errs       []error
+}
+
+// resolve follows local $refs like "#/$defs/Name".
+func (v *strictSchemaValidator) resolve(node map[string]any) map[string]any {
+	for range maxSchemaDepth {
+		ref, ok := node["$ref"].(string)
+		if !ok || !strings.HasPrefix(ref, "#/") {
+			return node
+		}
+		var target any = v.schema
+		for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+			m, _ := target.(map[string]any)
+			target = m[part]
+		}
+		resolved, ok := target.(map[string]any)
+		if !ok {
+			v.errs = append(v.errs, fmt.Errorf("schema: unresolvable $ref %q", ref))
+			return node
+		}
+		node = resolved
+	}
+	return node
+}
+
+func (v *strictSchemaValidator) walk(node map[string]any, at string, depth int, visiting map[string]bool) {
+	if ref, ok := node["$ref"].(string); ok {
+		// recursive schemas are allowed, every definition is checked once per path
+		if visiting[ref] {
+			return
+		}
+		visiting[ref] = true
+		defer delete(visiting, ref)
+		node = v.resolve(node)
+	}
+	if depth > maxSchemaDepth {
+		v.errs = append(v.errs, fmt.Errorf("%s: nesting exceeds %d levels", at, maxSchemaDepth))
+		return
+	}
+
+	if properties, ok := node["properties"].(map[string]any); ok {
+		v.properties += len(properties)
+		if additional, ok := node["additionalProperties"].(bool); !ok || additional {
+			v.errs = append(v.errs, fmt.Errorf("%s: additionalProperties must be false", at))
+		}
+		required := make(map[string]bool)
+		if list, ok := node["required"].([]any); ok {
+			for _, name := range list {
+				if s, ok := name.(string); ok {
+					required[s] = true
+				}
+			}
+		}
+		for name, property := range properties {
+			if !required[name] {
+				v.errs = append(v.errs, fmt.Errorf("%s: property %q must be required", at, name))
+			}
+			if child, ok := property.(map[string]any); ok {
+				v.walk(child, at+"."+name, depth+1, visiting)
+			}
+		}
+	}
+	if items, ok := node["items"].(map[string]any); ok {
+		v.walk(items, at+"[]", depth+1, visiting)
+	}
+	for _, keyword := range []string{"anyOf", "oneOf", "allOf"} {
+		variants, ok := node[keyword].([]any)
+		if !ok {
+			continue
+		}
+		if keyword != "anyOf" {
+			v.errs = append(v.errs, fmt.Errorf("%s: %s is not supported, use anyOf", at, keyword))
+		}
+		for i, variant := range variants {
+			if child, ok := variant.(map[string]any); ok {
+				v.walk(child, fmt.Sprintf("%s.%s[%d]", at, keyword, i), depth, visiting)
+			}
+		}
+	}
+}
+
+func validateInputLine(line gptBatchInputLine) error {
+	if line.CustomId == "" {
+		return errors.New("custom_id is missing")
+	}
+	if line.Method != "POST" {
+		return fmt.Errorf("method must be POST, got %q", line.Method)
+	}
+	switch line.Url {
+	case EndpointChatCompletions, EndpointEmbeddings, EndpointResponses:
+	default:
+		return fmt.Errorf("unsupported url %q", line.Url)
+	}
+	if len(line.Body) == 0 || line.Body[0] != '{' {
+		return errors.New("body must be a JSON object")
+	}
+	return nil
+}
+
+// readRawLines splits r into lines without their line break.
+func readRawLines(r io.Reader) ([][]byte, error) {
+	lines := make([][]byte, 0)
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			lines = append(lines, bytes.TrimRight(line, "\r\n"))
+		}
+		if errors.Is(err, io.EOF) {
+			return lines, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package gpt
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func chatLine(customId, body string) string {
+	return fmt.Sprintf(`{"custom_id":%q,"method":"POST","url":"/v1/chat/completions","body":%s}`, customId, body)
+}
+
+func schemaLine(customId, schema string) string {
+	return chatLine(customId, `{"model":"gpt-4o-mini","messages":[{"role":"user","content":"hi"}],`+
+		`"response_format":{"type":"json_schema","json_schema":{"name":"answer","strict":true,"schema":`+schema+`}}}`)
+}
+
+const chatBody = `{"model":"gpt-4o-mini","messages":[{"role":"user","content":"hi"}]}`
+
+func TestValidateBatchInput(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		// want is part of the message of the only error, empty if the input is valid
+		want string
+	}{
+		{"valid", []string{
+			chatLine("a", chatBody),
+			"",
+			schemaLine("b", `{"type":"object","properties":{"x":{"type":"string"}},"required":["x"],"additionalProperties":false}`),
+		}, ""},
+		{"invalid json", []string{`{"custom_id":`}, "unexpected end of JSON input"},
+		{"missing custom_id", []string{chatLine("", chatBody)}, "custom_id is missing"},
+		{"method", []string{`{"custom_id":"a","method":"GET","url":"/v1/chat/completions","body":{}}`}, "method must be POST"},
+		{"unsupported url", []string{`{"custom_id":"a","method":"POST","url":"/v1/completions","body":{}}`}, "unsupported url"},
+		{"body not an object", []string{chatLine("a", `"hi"`)}, "body must be a JSON object"},
+		{"duplicate custom_id", []string{chatLine("a", chatBody), chatLine("a", chatBody)}, "custom_id is already used in line 1"},
+		{"mixed urls", []string{
+			chatLine("a", chatBody),
+			`{"custom_id":"b","method":"POST","url":"/v1/responses","body":{"model":"gpt-4o-mini","input":"hi"}}`,
+		}, "differs from /v1/chat/completions in line 1"},
+		{"mixed models", []string{
+			chatLine("a", chatBody),
+			chatLine("b", `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`),
+		}, "model gpt-4o differs from gpt-4o-mini in line 1"},
+		{"missing model", []string{chatLine("a", `{"messages":[{"role":"user","content":"hi"}]}`)}, "body.model is missing"},
+		{"missing messages", []string{chatLine("a", `{"model":"gpt-4o-mini","messages":[]}`)}, "body.messages is missing"},
+		{"missing input", []string{`{"custom_id":"a","method":"POST","url":"/v1/embeddings","body":{"model":"text-embedding-3-small"}}`}, "body.input is missing"},
+		{"missing json_schema", []string{chatLine("a", `{"model":"gpt-4o-mini","messages":[{"role":"user","content":"hi"}],"response_format":{"type":"json_schema"}}`)}, "json_schema is missing"},
+		{"schema name", []string{chatLine("a", `{"model":"gpt-4o-mini","messages":[{"role":"user","content":"hi"}],`+
+			`"response_format":{"type":"json_schema","json_schema":{"name":"an answer","schema":{"type":"object"}}}}`)}, `schema name "an answer"`},
+		{"root not an object", []string{schemaLine("a", `{"type":"array","items":{"type":"string"}}`)}, "the root must be an object"},
+		{"additional properties", []string{schemaLine("a", `{"type":"object","properties":{"x":{"type":"string"}},"required":["x"]}`)}, "additionalProperties must be false"},
+		{"optional property", []string{schemaLine("a", `{"type":"object","properties":{"x":{"type":"string"}},"additionalProperties":false}`)}, `property "x" must be required`},
+		{"oneOf", []string{schemaLine("a", `{"type":"object","oneOf":[{"type":"object"}]}`)}, "oneOf is not supported"},
+		{"unresolvable ref", []string{schemaLine("a", `{"type":"object","properties":{"x":{"$ref":"#/$defs/missing"}},"required":["x"],"additionalProperties":false}`)}, `unresolvable $ref "#/$defs/missing"`},
+		{"nesting", []string{schemaLine("a", nestedSchema(maxSchemaDepth+1))}, "nesting exceeds"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := ValidateBatchInput(strings.NewReader(strings.Join(tt.lines, "\n") + "\n"))
+			if tt.want == "" {
+				if len(errs) > 0 {
+					t.Fatalf("want no errors, got %v", errs)
+				}
+				return
+			}
+			if len(errs) != 1 || !strings.Contains(errs[0].Error(), tt.want) {
+				t.Fatalf("want one error containing %q, got %v", tt.want, errs)
+			}
+		})
+	}
+}
+
+// nestedSchema returns a strict object schema with depth levels of objects.
+func nestedSchema(depth int) string {
+	schema := `{"type":"object","properties":{},"required":[],"additionalProperties":false}`
+	for range depth - 1 {
+		schema = `{"type":"object","properties":{"x":` + schema + `},"required":["x"],"additionalProperties":false}`
+	}
+	return schema
+}
+
+func TestValidateBatchInputLimits(t *testing.T) {
+	requests, size := maxBatchRequests, maxBatchFileSize
+	t.Cleanup(func() { maxBatchRequests, maxBatchFileSize = requests, size })
+
+	input := chatLine("a", chatBody) + "\n" + chatLine("b", chatBody) + "\n"
+	maxBatchRequests, maxBatchFileSize = 1, len(input)
+	errs := ValidateBatchInput(strings.NewReader(input))
+	if len(errs) != 1 || errs[0].Line != 0 || !strings.Contains(errs[0].Error(), "2 requests exceed the limit of 1") {
+		t.Fatalf("want the request limit error, got %v", errs)
+	}
+
+	maxBatchRequests, maxBatchFileSize = 2, len(input)-1
+	errs = ValidateBatchInput(strings.NewReader(input))
+	if len(errs) != 1 || errs[0].Line != 0 || !strings.Contains(errs[0].Error(), "bytes exceed the limit") {
+		t.Fatalf("want the size limit error, got %v", errs)
+	}
+}
@@ -0,0 +1,264 @@
+package gpt
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path"
+	"sort"
+	"sync"
+
+	"github.com/FrauElster/goerror"
+)
+
+var (
+	ErrVectorDimension  = goerror.New("gpt:vector_dimension", "Vector dimension mismatch")
+	ErrPersistVectors   = goerror.New("gpt:persist_vectors", "Failed to persist vector index")
+	ErrNoCacheDirectory = goerror.New("gpt:no_cache_directory", "No cache directory configured")
+	ErrVectorMetric     = goerror.New("gpt:vector_metric", "Unknown vector metric")
+)
+
+type VectorMetric string
+
+const (
+	MetricCosine     VectorMetric = "cosine"
+	MetricDotProduct VectorMetric = "dot"
+)
+
+// VectorMatch is a single search result of a VectorIndex.
+type VectorMatch struct {
+	Id    string
+	Score float32
+}
+
+// VectorIndex is a small in-process vector store keyed by custom_id.
+// Search is exhaustive, which is fast enough for some hundred thousand vectors.
+// It is safe for concurrent use.
+type VectorIndex struct {
+	name     string
+	cacheDir string
+
+	mu        sync.RWMutex
+	ids       []string
+	vectors   [][]float32
+	norms     []float32
+	positions map[string]int
+}
+
+// persistedVectorIndex is the on-disk representation of a VectorIndex.
+type persistedVectorIndex struct {
+	Ids     []string
+	Vectors [][]float32
+}
+
+// NewVectorIndex creates a vector index with the given name.
+// If the Gpt instance has a cache directory and the index was saved before, it is loaded from there.
+func (g *Gpt) NewVectorIndex(name string) (*VectorIndex, goerror.TraceableError) {
+	idx := &VectorIndex{name: name, cacheDir: g.cacheDir, positions: make(map[string]int)}
+	if idx.cacheDir == "" {
+		return idx, nil
+	}
+
+	f, err := os.Open(idx.filepath())
+	if errors.Is(err, os.ErrNotExist) {
+		return idx, nil
+	}
+	if err != nil {
+		return nil, ErrPersistVectors.WithError(err).WithOrigin()
+	}
+	defer f.Close()
+
+	var persisted persistedVectorIndex
+	if err := gob.NewDecoder(f).Decode(&persisted); err != nil {
+		err = fmt.Errorf("failed to decode %s: %w", idx.filepath(), err)
+		return nil, ErrPersistVectors.WithError(err).WithOrigin()
+	}
+	if len(persisted.Ids) != len(persisted.Vectors) {
+		err := fmt.Errorf("%s has %d ids but %d vectors", idx.filepath(), len(persisted.Ids), len(persisted.Vectors))
+		return nil, ErrPersistVectors.WithError(err).WithOrigin()
+	}
+	for i, id := range persisted.Ids {
+		if err := idx.Add(id, persisted.Vectors[i]); err != nil {
+			return nil, ErrPersistVectors.WithError(fmt.Errorf("%s is corrupt: %w", idx.filepath(), err)).WithOrigin()
+		}
+	}
+	return idx, nil
+}
+
+func (idx *VectorIndex) filepath() string {
+	return path.Join(idx.cacheDir, idx.name+".vectors.gob")
+}
+
+// Len returns the number of vectors in the index.
+func (idx *VectorIndex) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return len(idx.ids)
+}
+
+// Add adds or replaces the vector for id, the index keeps a copy of it.
+// All vectors of an index must have the same, non-zero dimension.
+func (idx *VectorIndex) Add(id string, vector []float32) goerror.TraceableError {
+	if len(vector) == 0 {
+		return ErrVectorDimension.WithError(fmt.Errorf("vector %q is empty", id)).WithOrigin()
+	}
+	vector = append([]float32(nil), vector...)
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if len(idx.vectors) > 0 && len(idx.vectors[0]) != len(vector) {
+		err := fmt.Errorf("index has dimension %d, vector %q has %d", len(idx.vectors[0]), id, len(vector))
+		return ErrVectorDimension.WithError(err).WithOrigin()
+	}
+
+	if pos, ok := idx.positions[id]; ok {
+		idx.vectors[pos] = vector
+		idx.norms[pos] = norm(vector)
+		return nil
+	}
+	idx.positions[id] = len(idx.ids)
+	idx.ids = append(idx.ids, id)
+	idx.vectors = append(idx.vectors, vector)
+	idx.norms = append(idx.norms, norm(vector))
+	return nil
+}
+
+// AddAll adds all vectors, for example the result of GptEmbeddingBatchSession.RetrieveEmbeddings.
+func (idx *VectorIndex) AddAll(vectors map[string][]float32) goerror.TraceableError {
+	for id, vector := range vectors {
+		if err := idx.Add(id, vector); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Remove removes the vector for id and reports whether it existed.
+func (idx *VectorIndex) Remove(id string) bool {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	pos, ok := idx.positions[id]
+	if !ok {
+		return false
+	}
+
+	// swap with the last element to keep the slices dense
+	last := len(idx.ids) - 1
+	idx.ids[pos], idx.vectors[pos], idx.norms[pos] = idx.ids[last], idx.vectors[last], idx.norms[last]
+	idx.positions[idx.ids[pos]] = pos
+	idx.ids, idx.vectors, idx.norms = idx.ids[:last], idx.vectors[:last], idx.norms[:last]
+	delete(idx.positions, id)
+	return true
+}
+
+// Get returns a copy of the vector for id.
+func (idx *VectorIndex) Get(id string) ([]float32, bool) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	pos, ok := idx.positions[id]
+	if !ok {
+		return nil, false
+	}
+	return append([]float32(nil), idx.vectors[pos]...), true
+}
+
+// Search returns the k vectors most similar to query, best match first.
+func (idx *VectorIndex) Search(query []float32, k int, metric VectorMetric) ([]VectorMatch, goerror.TraceableError) {
+	return idx.search(query, k, metric, "")
+}
+
+// SearchSimilar returns the k vectors most similar to the vector of id, excluding id itself.
+func (idx *VectorIndex) SearchSimilar(id string, k int, metric VectorMetric) ([]VectorMatch, goerror.TraceableError) {
+	query, ok := idx.Get(id)
+	if !ok {
+		return nil, nil
+	}
+	return idx.search(query, k, metric, id)
+}
+
+func (idx *VectorIndex) search(query []float32, k int, metric VectorMetric, exclude string) ([]VectorMatch, goerror.TraceableError) {
+	if metric != MetricCosine && metric != MetricDotProduct {
+		return nil, ErrVectorMetric.WithError(fmt.Errorf("metric %q is neither %q nor %q", metric, MetricCosine, MetricDotProduct)).WithOrigin()
+	}
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	if k <= 0 || len(idx.ids) == 0 {
+		return nil, nil
+	}
+	if len(idx.vectors[0]) != len(query) {
+		err := fmt.Errorf("index has dimension %d, query has %d", len(idx.vectors[0]), len(query))
+		return nil, ErrVectorDimension.WithError(err).WithOrigin()
+	}
+
+	queryNorm := norm(query)
+	matches := make([]VectorMatch, 0, len(idx.ids))
+	for i, vector := range idx.vectors {
+		if idx.ids[i] == exclude {
+			continue
+		}
+		score := dot(query, vector)
+		if metric == MetricCosine {
+			if queryNorm == 0 || idx.norms[i] == 0 {
+				score = 0
+			} else {
+				score /= queryNorm * idx.norms[i]
+			}
+		}
+		matches = append(matches, VectorMatch{Id: idx.ids[i], Score: score})
+	}
+
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Score > matches[j].Score })
+	if len(matches) > k {
+		matches = matches[:k]
+	}
+	return matches, nil
+}
+
+// Save persists the index to the cache directory of the Gpt instance it was created with.
+func (idx *VectorIndex) Save() goerror.TraceableError {
+	if idx.cacheDir == "" {
+		return ErrNoCacheDirectory.WithOrigin()
+	}
+
+	idx.mu.RLock()
+	persisted := persistedVectorIndex{Ids: idx.ids, Vectors: idx.vectors}
+	// write to a temporary file first, so a crash does not leave a corrupt index behind,
+	// each Save gets its own, so concurrent ones do not write into the same file
+	f, err := os.CreateTemp(idx.cacheDir, idx.name+".vectors.gob.*.tmp")
+	if err != nil {
+		idx.mu.RUnlock()
+		return ErrPersistVectors.WithError(err).WithOrigin()
+	}
+	err = gob.NewEncoder(f).Encode(persisted)
+	idx.mu.RUnlock()
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), idx.filepath())
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return ErrPersistVectors.WithError(err).WithOrigin()
+	}
+	return nil
+}
+
+func dot(a, b []float32) float32 {
+	var sum float32
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
+
+func norm(v []float32) float32 {
+	return float32(math.Sqrt(float64(dot(v, v))))
+}